@@ -0,0 +1,159 @@
+package main
+
+import (
+    "bufio"
+    "flag"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "strings"
+
+    "github.com/tomasnunes/invasion/pkg/worldx"
+)
+
+// Arguments of every map editing command, after the map file.
+var mapCommandArgs = map[string][]string{
+    "add-city":   {"CITY"},
+    "connect":    {"CITY", "DIRECTION", "OTHER_CITY"},
+    "disconnect": {"CITY", "DIRECTION"},
+    "rm-city":    {"CITY"},
+    "rename":     {"CITY", "NEW_NAME"},
+    "merge":      {"OTHER_FILE"},
+}
+
+// Edits the world map of the file with the command in the arguments, validates it and prints it in canonical form
+// with its comments and directives, or writes it back to the file with -w. Maps with parts that couldn't be read as
+// written, e.g. two roads north of a city, aren't edited since they would be lost.
+func EditMap(args []string, writer *bufio.Writer) {
+    if len(args) == 0 || mapCommandArgs[args[0]] == nil {
+        printUsage()
+        os.Exit(2)
+    }
+    command := args[0]
+
+    flags := flag.NewFlagSet("map "+command, flag.ExitOnError)
+    flags.Usage = printUsage
+    inPlace := flags.Bool("w", false, "Writes the map back to the file instead of the stdout.")
+    oneWay := flags.Bool("one-way", false, "connect adds a road only from CITY to OTHER_CITY.")
+    length := flags.Int("length", 1, "connect adds a road that takes LENGTH iterations to travel.")
+    if err := flags.Parse(args[1:]); err != nil {
+        log.Panic(err)
+    }
+    if flags.NArg() != 1+len(mapCommandArgs[command]) {
+        defer printUsage()
+        log.Panicf("map %s expects MAP_FILE %s", command, strings.Join(mapCommandArgs[command], " "))
+    }
+    filename, commandArgs := flags.Arg(0), flags.Args()[1:]
+
+    world := readEditedWorld(filename)
+    var err error
+    switch command {
+    case "add-city":
+        if _, ok := world.Cities[commandArgs[0]]; ok {
+            err = fmt.Errorf("there's already a city named %s", commandArgs[0])
+        } else {
+            world.CreateCity(commandArgs[0])
+        }
+    case "connect":
+        err = connectCities(world, commandArgs[0], commandArgs[1], commandArgs[2], *length, *oneWay)
+    case "disconnect":
+        var dir worldx.Direction
+        if dir, err = mapDirection(world, commandArgs[1]); err == nil {
+            if city, ok := world.Cities[commandArgs[0]]; !ok {
+                err = fmt.Errorf("there's no city named %s", commandArgs[0])
+            } else {
+                err = world.RemoveConnection(city, dir)
+            }
+        }
+    case "rm-city":
+        err = world.DeleteCity(commandArgs[0])
+    case "rename":
+        err = world.RenameCity(commandArgs[0], commandArgs[1])
+    case "merge":
+        if errs := world.Merge(readEditedWorld(commandArgs[0])); len(errs) > 0 {
+            err = joinErrors(errs)
+        }
+    }
+    if err != nil {
+        log.Panicf("%s: %v", filename, err)
+    }
+    if errs := world.Validate(); len(errs) > 0 {
+        log.Panicf("%s: the edited map isn't valid: %v", filename, joinErrors(errs))
+    }
+
+    if *inPlace {
+        writeFile(filename, func(writer io.Writer) error {
+            _, err := io.WriteString(writer, world.String())
+            return err
+        })
+        return
+    }
+    if _, err := fmt.Fprint(writer, world.String()); err != nil {
+        log.Panic(err)
+    }
+    if err := writer.Flush(); err != nil {
+        log.Panic(err)
+    }
+}
+
+// Reads the world of a map file to edit, panics if parts of the map were ignored since the edited map would lose them.
+func readEditedWorld(filename string) *worldx.WorldX {
+    world, diagnostics := readWorldWithDiagnostics(filename, worldx.ReadOptions{})
+    for _, diagnostic := range diagnostics {
+        if diagnostic.Unfixable {
+            log.Panicf("%s: can't edit a map with conflicts, fix them first", filename)
+        }
+    }
+    return world
+}
+
+// Returns the direction with the name or alias, if the world has it.
+func mapDirection(world *worldx.WorldX, name string) (worldx.Direction, error) {
+    dir := world.GetDirection(name)
+    if !dir.IsValid() || !world.HasDirection(dir) {
+        return worldx.UnknownDirection, fmt.Errorf("the map doesn't have direction %s", name)
+    }
+    return dir, nil
+}
+
+// Adds a road from the city to the other in the direction, and back unless it's one-way. Returns an error if any of
+// the cities already has a road in the direction of the new road to another city.
+func connectCities(world *worldx.WorldX, name string, dirName string, otherName string, length int,
+    oneWay bool) error {
+    dir, err := mapDirection(world, dirName)
+    if err != nil {
+        return err
+    }
+    city, other := world.Cities[name], world.Cities[otherName]
+    if city == nil || other == nil {
+        return fmt.Errorf("can only connect cities of the map, %s and %s", name, otherName)
+    } else if city == other {
+        return fmt.Errorf("can't connect %s to itself", name)
+    } else if length < 1 {
+        return fmt.Errorf("invalid road length %d, should be positive", length)
+    } else if connection := city.Connection(dir); connection != nil {
+        return fmt.Errorf("%s already has a road %v to %s", name, dir, connection.Name())
+    } else if !oneWay && !world.HasDirection(dir.GetOpposite()) {
+        return fmt.Errorf("the map doesn't have direction %v for the road back", dir.GetOpposite())
+    } else if connection = other.Connection(dir.GetOpposite()); connection != nil && !oneWay {
+        return fmt.Errorf("%s already has a road %v to %s", otherName, dir.GetOpposite(), connection.Name())
+    }
+
+    if oneWay {
+        world.AddOneWayConnection(city, other, dir)
+    } else {
+        world.AddConnection(city, other, dir)
+    }
+    world.SetRoadLength(city, dir, length)
+    return nil
+}
+
+// Returns an error with the messages of the errors, one per line.
+func joinErrors(errs []error) error {
+    messages := make([]string, len(errs))
+    for i, err := range errs {
+        messages[i] = err.Error()
+    }
+    return fmt.Errorf("%s", strings.Join(messages, "\n"))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "flag"
+    "fmt"
+    "io"
+    "log"
+    "os"
+
+    "github.com/tomasnunes/invasion/pkg/worldx"
+)
+
+// Rewrites the world map files in the arguments in canonical form, every road back explicit, duplicates removed and
+// cities sorted by name, keeping their comments and directives, and prints them or writes them back with -w. Files
+// with conflicts it can't fix, e.g. two roads north of a city, are logged and left as they are, and the command exits
+// with status 1. With --check only prints the files that aren't formatted and exits with status 1 if any. Reads the
+// map from the stdin if no file is given.
+func Format(args []string, writer *bufio.Writer) {
+    flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+    flags.Usage = printUsage
+    check := flags.Bool("check", false, "Prints the files that aren't formatted and exits with status 1 if any.")
+    inPlace := flags.Bool("w", false, "Writes the formatted maps back to their files instead of the stdout.")
+    if err := flags.Parse(args); err != nil {
+        log.Panic(err)
+    }
+    if *inPlace && flags.NArg() == 0 {
+        defer printUsage()
+        log.Panic("fmt -w needs the files to write")
+    }
+
+    filenames := flags.Args()
+    if len(filenames) == 0 {
+        filenames = []string{"-"}
+    }
+    unformatted := false
+    for _, filename := range filenames {
+        var content []byte
+        var err error
+        if filename == "-" {
+            content, err = io.ReadAll(os.Stdin)
+        } else {
+            content, err = os.ReadFile(filename)
+        }
+        if err != nil {
+            log.Panic(err)
+        }
+
+        formatted, ok := formatMap(filename, content)
+        switch {
+        case !ok && !*check:
+            unformatted = true
+        case *check:
+            if !ok || formatted != string(content) {
+                unformatted = true
+                if _, err := fmt.Fprintln(writer, filename); err != nil {
+                    log.Panic(err)
+                }
+            }
+        case *inPlace:
+            if formatted != string(content) {
+                writeFile(filename, func(writer io.Writer) error {
+                    _, err := io.WriteString(writer, formatted)
+                    return err
+                })
+            }
+        default:
+            if _, err := fmt.Fprint(writer, formatted); err != nil {
+                log.Panic(err)
+            }
+        }
+    }
+
+    if err := writer.Flush(); err != nil {
+        log.Panic(err)
+    }
+    if unformatted {
+        os.Exit(1)
+    }
+}
+
+// Returns the world map in canonical form, logging the diagnostics of reading it, such as conflicting roads, and
+// false if any of them couldn't be fixed, since the canonical form would lose what was ignored.
+func formatMap(filename string, content []byte) (string, bool) {
+    world := worldx.WorldX{}
+    diagnostics, err := world.ReadWorldMapWithOptions(bytes.NewReader(content), worldx.ReadOptions{})
+    fixable := true
+    for _, diagnostic := range diagnostics {
+        log.Printf("%s: %v", filename, diagnostic)
+        fixable = fixable && !diagnostic.Unfixable
+    }
+    if err != nil {
+        log.Panicf("%s: %v", filename, err)
+    }
+    for _, err := range world.Validate() {
+        log.Printf("%s: %v", filename, err)
+    }
+    return world.String(), fixable
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+    "bufio"
+    "flag"
+    "io"
+    "log"
+    "time"
+
+    "github.com/tomasnunes/invasion/pkg/worldx/generate"
+)
+
+// Generates a world map with the topology, size and seed in the arguments and prints it in canonical form, or writes
+// it to the output file. Random seeds are logged so the map can be generated again.
+func Generate(args []string, writer *bufio.Writer) {
+    flags := flag.NewFlagSet("generate", flag.ExitOnError)
+    flags.Usage = printUsage
+    topologyName := flags.String("topology", "grid", "Topology of the map, grid, holes, maze or lattice.")
+    width := flags.Int("width", 0, "Columns of the grid of cities, 0 for the default.")
+    height := flags.Int("height", 0, "Rows of the grid of cities, 0 for the width.")
+    seed := flags.Int64("seed", 0, "Seed of the map, 0 for a random seed.")
+    holes := flags.Float64("holes", 0, "Chance of each city being left out of a grid with holes, 0 for the default.")
+    density := flags.Float64("density", 0, "Fraction of the possible roads of a lattice, 0 for the default.")
+    pronounceable := flags.Bool("pronounceable", false, "Names the cities with pronounceable names.")
+    output := flags.String("output", "", "Name of the output file, the stdout if none provided.")
+    if err := flags.Parse(args); err != nil {
+        log.Panic(err)
+    }
+
+    topology, ok := generate.GetTopology(*topologyName)
+    if !ok {
+        defer printUsage()
+        log.Panicf("unknown topology %s", *topologyName)
+    }
+    if *seed == 0 {
+        *seed = time.Now().UnixNano()
+        log.Printf("generating %s map with seed %d", topology, *seed)
+    }
+    world, err := generate.Generate(generate.Options{Topology: topology, Width: *width, Height: *height, Seed: *seed,
+        HoleChance: *holes, Density: *density, Pronounceable: *pronounceable})
+    if err != nil {
+        defer printUsage()
+        log.Panic(err)
+    }
+
+    write := func(writer io.Writer) error {
+        _, err := io.WriteString(writer, world.String())
+        return err
+    }
+    if *output != "" {
+        writeFile(*output, write)
+        return
+    }
+    if err := write(writer); err != nil {
+        log.Panic(err)
+    }
+    if err := writer.Flush(); err != nil {
+        log.Panic(err)
+    }
+}
@@ -2,18 +2,27 @@ package main
 
 import (
     "bufio"
+    "encoding/json"
     "flag"
     "fmt"
+    "io"
     "log"
     "os"
+    "sort"
     "strconv"
+    "strings"
+    "time"
 
     "github.com/tomasnunes/invasion/pkg/worldx"
+    "github.com/tomasnunes/invasion/pkg/worldx/analysis"
 )
 
 const (
     defaultNumberAliens int    = 10
     defaultInputFile    string = "test/world_map"
+    defaultBatchRuns    int    = 1000
+    commentLinePrefix   string = "# "
+    maxCentralCities    int    = 10
 )
 
 func printUsage() {
@@ -22,6 +31,15 @@ func printUsage() {
             "\n"+
             "Usage:\n"+
             "%s [-h] [N] [INPUT_FILE] [OUTPUT_FILE]\n"+
+            "%[1]s batch [--runs RUNS] [--aliens N] [--map INPUT_FILE] [--iterations ITERATIONS] [--seed SEED] [--workers WORKERS]\n"+
+            "%[1]s simulate [--aliens N] [--map INPUT_FILE] [--iterations ITERATIONS] [--seed SEED] [--output OUTPUT_FILE]\n"+
+            "\t[--checkpoint CHECKPOINT_FILE] [--checkpoint-every K] [--resume CHECKPOINT_FILE] [--rounds ROUNDS]\n"+
+            "\t[--diff] [--diff-format unified|json]\n"+
+            "%[1]s stats INPUT_FILE [FROM TO]\n"+
+            "%[1]s map add-city|connect|disconnect|rm-city|rename|merge [-w] [--one-way] [--length LENGTH] MAP_FILE ARGS...\n"+
+            "%[1]s fmt [--check] [-w] [FILE...]\n"+
+            "%[1]s generate [--topology grid|holes|maze|lattice] [--width WIDTH] [--height HEIGHT] [--seed SEED]\n"+
+            "\t[--holes CHANCE] [--density DENSITY] [--pronounceable] [--output OUTPUT_FILE]\n"+
             "\n"+
             "Flags:\n"+
             "-h\t\tPrints this message.\n"+
@@ -29,11 +47,43 @@ func printUsage() {
             "Args:\n"+
             "N\t\tNumber of alien invaders, if none provided defaults to %d.\n"+
             "INPUT_FILE\tName of the input file with the world map description, if none provided defaults to '%s'.\n"+
-            "OUTPUT_FILE\tName of the output file to create and print program information, if none provided defaults to the stdout.\n",
+            "OUTPUT_FILE\tName of the output file to create and print program information, if none provided defaults to the stdout.\n"+
+            "\n"+
+            "Commands:\n"+
+            "batch\t\tRuns many independent simulations of the map and prints their aggregate statistics.\n"+
+            "simulate\tRuns a simulation of the map that can be checkpointed every K iterations and resumed later, or\n"+
+            "\t\tROUNDS invasions back to back, and prints a map that can be read back.\n"+
+            "stats\t\tPrints the graph metrics of the map, and the shortest path from FROM to TO if provided.\n"+
+            "map\t\tEdits the map and prints it in canonical form, or writes it back to MAP_FILE with -w:\n"+
+            "\t\tadd-city CITY, connect CITY DIRECTION OTHER_CITY, disconnect CITY DIRECTION, rm-city CITY,\n"+
+            "\t\trename CITY NEW_NAME, merge OTHER_FILE.\n"+
+            "fmt\t\tRewrites the maps in canonical form and reports the conflicts it couldn't fix, with --check\n"+
+            "\t\tprints the files that aren't formatted and exits with status 1 if any.\n"+
+            "generate\tGenerates a map of a grid, a grid with holes, a maze or a lattice of cities.\n",
         os.Args[0], defaultNumberAliens, defaultInputFile)
 }
 
 func main() {
+    if len(os.Args) > 1 && os.Args[1] == "batch" {
+        Batch(os.Args[2:], bufio.NewWriter(os.Stdout))
+        return
+    } else if len(os.Args) > 1 && os.Args[1] == "simulate" {
+        Simulate(os.Args[2:])
+        return
+    } else if len(os.Args) > 1 && os.Args[1] == "stats" {
+        Stats(os.Args[2:], bufio.NewWriter(os.Stdout))
+        return
+    } else if len(os.Args) > 1 && os.Args[1] == "map" {
+        EditMap(os.Args[2:], bufio.NewWriter(os.Stdout))
+        return
+    } else if len(os.Args) > 1 && os.Args[1] == "fmt" {
+        Format(os.Args[2:], bufio.NewWriter(os.Stdout))
+        return
+    } else if len(os.Args) > 1 && os.Args[1] == "generate" {
+        Generate(os.Args[2:], bufio.NewWriter(os.Stdout))
+        return
+    }
+
     var helpFlag bool
     flag.BoolVar(&helpFlag, "h", false, "Prints usage message.")
     flag.Parse()
@@ -100,11 +150,31 @@ func Invade(filename string, numberAliens int, writer *bufio.Writer) {
 
     world := worldx.WorldX{}
 
-    scanner := bufio.NewScanner(file)
-    world.ReadWorldMap(scanner)
+    diagnostics, err := world.ReadWorldMapWithOptions(file, worldx.ReadOptions{})
+    for _, diagnostic := range diagnostics {
+        log.Printf("%s: %v", filename, diagnostic)
+    }
+    if err != nil {
+        log.Panic(err)
+    }
     world.GenerateAliens(numberAliens)
     world.RunSimulation(writer)
+    if _, err := fmt.Fprintln(writer, world.Summary()); err != nil {
+        log.Panic(err)
+    }
+    printWorld(&world, writer, writer)
+}
 
+// Prints the region statistics to the stats writer and the map of the world to the writer.
+func printWorld(world *worldx.WorldX, stats *bufio.Writer, writer *bufio.Writer) {
+    for _, regionStats := range world.RegionStats() {
+        if _, err := fmt.Fprintln(stats, regionStats); err != nil {
+            log.Panic(err)
+        }
+    }
+    if err := stats.Flush(); err != nil {
+        log.Panic(err)
+    }
     if _, err := fmt.Fprint(writer, world.String()); err != nil {
         log.Panic(err)
     }
@@ -112,3 +182,401 @@ func Invade(filename string, numberAliens int, writer *bufio.Writer) {
         log.Panic(err)
     }
 }
+
+// Writer that starts every line with a comment of the map format, so the events and statistics printed before a world
+// map don't stop it from being read back.
+type commentWriter struct {
+    writer  io.Writer
+    midLine bool // The last byte written didn't end a line
+}
+
+func (c *commentWriter) Write(p []byte) (int, error) {
+    buf := make([]byte, 0, len(p)+len(commentLinePrefix))
+    for _, b := range p {
+        if !c.midLine {
+            buf = append(buf, commentLinePrefix...)
+        }
+        buf = append(buf, b)
+        c.midLine = b != '\n'
+    }
+    if _, err := c.writer.Write(buf); err != nil {
+        return 0, err
+    }
+    return len(p), nil
+}
+
+// Runs a simulation of the world map described on the file, or resumes the one of a checkpoint, with the flags in the
+// arguments, writing a checkpoint every K iterations, and prints the final state of the world. With K rounds the
+// invasion is repeated on the cities left by the previous round with fresh aliens. Events and statistics are printed
+// as comments, so the output can be read back as the map of another simulation, which ignores the comments.
+func Simulate(args []string) {
+    flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+    flags.Usage = printUsage
+    numberAliens := flags.Int("aliens", defaultNumberAliens, "Number of alien invaders.")
+    filename := flags.String("map", defaultInputFile, "Name of the input file with the world map description.")
+    iterations := flags.Int("iterations", 0, "Iterations of the simulation, 0 for the default or the checkpoint's.")
+    seed := flags.Int64("seed", 0, "Seed of the simulation, 0 for a random seed.")
+    output := flags.String("output", "", "Name of the output file, the stdout if none provided.")
+    checkpointFile := flags.String("checkpoint", "", "Name of the file to write checkpoints to.")
+    checkpointEvery := flags.Int("checkpoint-every", 0, "Iterations between checkpoints, 0 for none.")
+    resume := flags.String("resume", "", "Name of the checkpoint file to resume the simulation from.")
+    rounds := flags.Int("rounds", 1, "Invasions to run back to back, each on the cities left by the previous one.")
+    diff := flags.Bool("diff", false, "Prints the changes of the world at the end.")
+    diffFormat := flags.String("diff-format", "unified", "Format of the changes, unified or json.")
+    if err := flags.Parse(args); err != nil {
+        log.Panic(err)
+    }
+    if *diffFormat != "unified" && *diffFormat != "json" {
+        defer printUsage()
+        log.Panicf("--diff-format should be unified or json, got %s", *diffFormat)
+    } else if *rounds < 1 {
+        defer printUsage()
+        log.Panicf("--rounds should be positive, got %d", *rounds)
+    } else if *rounds > 1 && (*checkpointEvery > 0 || *resume != "") {
+        defer printUsage()
+        log.Panic("--rounds can't be combined with checkpoints")
+    }
+    if *checkpointFile == "" {
+        *checkpointFile = *resume
+    }
+    if *checkpointEvery > 0 && *checkpointFile == "" {
+        defer printUsage()
+        log.Panic("--checkpoint-every needs a --checkpoint file")
+    }
+
+    writer := bufio.NewWriter(os.Stdout)
+    if *output != "" {
+        if outputFile, err := os.Create(*output); err != nil {
+            log.Panic(err)
+        } else {
+            defer func() {
+                if err := outputFile.Close(); err != nil {
+                    log.Panic(err)
+                }
+            }()
+            writer = bufio.NewWriter(outputFile)
+        }
+    }
+
+    var world *worldx.WorldX
+    var options worldx.SimulationOptions
+    if *resume != "" {
+        world = readCheckpoint(*resume)
+        options = world.Options()
+    } else {
+        // Comments of the map are left out, they're the events and statistics printed by the simulation it came from
+        world, _ = readWorldWithDiagnostics(*filename, worldx.ReadOptions{DropComments: true})
+        if options.Seed = *seed; options.Seed == 0 {
+            options.Seed = time.Now().UnixNano()
+        }
+        world.SetSeed(options.Seed)
+        world.GenerateAliens(*numberAliens)
+    }
+
+    if *iterations > 0 {
+        options.MaxIterations = *iterations
+    }
+    if *checkpointEvery > 0 {
+        options.CheckpointEvery = *checkpointEvery
+    }
+    if options.CheckpointEvery > 0 && *checkpointFile != "" {
+        options.OnCheckpoint = func(world *worldx.WorldX) {
+            writeCheckpoint(world, *checkpointFile)
+        }
+    }
+    comments := bufio.NewWriter(&commentWriter{writer: writer})
+    printf := func(format string, a ...interface{}) {
+        if _, err := fmt.Fprintf(comments, format, a...); err != nil {
+            log.Panic(err)
+        }
+    }
+
+    before := world.Clone()
+    var initialCities, destroyedCities, rebuiltCities int
+    for round := 1; round <= *rounds; round++ {
+        if round > 1 {
+            // The next round reads the map printed by the previous one, like a simulation of that output would
+            next, worldMap := &worldx.WorldX{}, strings.NewReader(world.String())
+            if _, err := next.ReadWorldMapWithOptions(worldMap, worldx.ReadOptions{DropComments: true}); err != nil {
+                log.Panic(err)
+            }
+            world = next
+            options.Seed++
+            world.SetSeed(options.Seed)
+            if aliens := *numberAliens; aliens < len(world.Cities) {
+                world.GenerateAliens(aliens)
+            } else {
+                world.GenerateAliens(len(world.Cities))
+            }
+            printf("Round %d\n", round)
+        } else if *rounds > 1 {
+            printf("Round %d\n", round)
+        }
+
+        world.RunSimulationWithOptions(comments, options)
+        summary := world.Summary()
+        if round == 1 {
+            initialCities = summary.Cities + summary.DestroyedCities - summary.RebuiltCities
+        }
+        destroyedCities, rebuiltCities = destroyedCities+summary.DestroyedCities, rebuiltCities+summary.RebuiltCities
+        printf("%v\n", summary)
+    }
+    if *rounds > 1 && initialCities > 0 {
+        printf("%d rounds: %d of %d cities destroyed (%.1f%%), %d rebuilt, %d left\n", *rounds, destroyedCities,
+            initialCities, 100*float64(destroyedCities)/float64(initialCities), rebuiltCities, len(world.Cities))
+    }
+    printWorld(world, comments, writer)
+    if *diff {
+        printDiff(worldx.Diff(before, world), *diffFormat, *output == "", comments)
+        if err := writer.Flush(); err != nil {
+            log.Panic(err)
+        }
+    }
+}
+
+// Prints the diff in the format, colored if it's unified and printed to a terminal.
+func printDiff(diff worldx.WorldDiff, format string, stdout bool, writer *bufio.Writer) {
+    var text string
+    if format == "json" {
+        data, err := json.MarshalIndent(diff, "", "  ")
+        if err != nil {
+            log.Panic(err)
+        }
+        text = string(data) + "\n"
+    } else {
+        color := false
+        if info, err := os.Stdout.Stat(); err == nil && stdout {
+            color = info.Mode()&os.ModeCharDevice != 0
+        }
+        text = diff.String() + diff.Unified(color)
+    }
+
+    if _, err := fmt.Fprint(writer, text); err != nil {
+        log.Panic(err)
+    }
+    if err := writer.Flush(); err != nil {
+        log.Panic(err)
+    }
+}
+
+// Reads the world of the map file, logging its diagnostics.
+func readWorld(filename string) *worldx.WorldX {
+    world, _ := readWorldWithDiagnostics(filename, worldx.ReadOptions{})
+    return world
+}
+
+// Reads the world of the map file with the options, logging and returning its diagnostics.
+func readWorldWithDiagnostics(filename string, options worldx.ReadOptions) (*worldx.WorldX, []worldx.Diagnostic) {
+    file, err := os.Open(filename)
+    if err != nil {
+        defer printUsage()
+        log.Panic(err)
+    }
+    defer func() {
+        if err = file.Close(); err != nil {
+            log.Panic(err)
+        }
+    }()
+
+    world := &worldx.WorldX{}
+    diagnostics, err := world.ReadWorldMapWithOptions(file, options)
+    for _, diagnostic := range diagnostics {
+        log.Printf("%s: %v", filename, diagnostic)
+    }
+    if err != nil {
+        log.Panicf("%s: %v", filename, err)
+    }
+    return world, diagnostics
+}
+
+// Reads the world of the checkpoint file.
+func readCheckpoint(filename string) *worldx.WorldX {
+    file, err := os.Open(filename)
+    if err != nil {
+        defer printUsage()
+        log.Panic(err)
+    }
+    defer func() {
+        if err = file.Close(); err != nil {
+            log.Panic(err)
+        }
+    }()
+
+    world, err := worldx.ReadCheckpoint(bufio.NewReader(file))
+    if err != nil {
+        log.Panicf("%s: %v", filename, err)
+    }
+    return world
+}
+
+// Writes the checkpoint of the world to the file.
+func writeCheckpoint(world *worldx.WorldX, filename string) {
+    writeFile(filename, func(writer io.Writer) error {
+        return world.WriteCheckpoint(writer)
+    })
+}
+
+// Writes to a temporary file first and then renames it to the file, so an interrupted write never leaves a broken
+// file behind.
+func writeFile(filename string, write func(writer io.Writer) error) {
+    temporary := filename + ".tmp"
+    file, err := os.Create(temporary)
+    if err != nil {
+        log.Panic(err)
+    }
+    writer := bufio.NewWriter(file)
+    if err = write(writer); err == nil {
+        err = writer.Flush()
+    }
+    if closeErr := file.Close(); err == nil {
+        err = closeErr
+    }
+    if err == nil {
+        err = os.Rename(temporary, filename)
+    }
+    if err != nil {
+        log.Panic(err)
+    }
+}
+
+// Runs a batch of independent simulations of the world map described on the file, with the flags in the arguments,
+// and prints the distribution of destroyed cities, how often each city is destroyed, the alien survival rate and the
+// percentiles of iterations until the simulations went quiet.
+func Batch(args []string, writer *bufio.Writer) {
+    flags := flag.NewFlagSet("batch", flag.ExitOnError)
+    flags.Usage = printUsage
+    runs := flags.Int("runs", defaultBatchRuns, "Number of simulations to run.")
+    numberAliens := flags.Int("aliens", defaultNumberAliens, "Number of alien invaders of every simulation.")
+    filename := flags.String("map", defaultInputFile, "Name of the input file with the world map description.")
+    iterations := flags.Int("iterations", 0, "Iterations of every simulation, 0 for the default.")
+    seed := flags.Int64("seed", 0, "Seed of the batch, 0 for a random seed.")
+    workers := flags.Int("workers", 0, "Simulations running at the same time, 0 for the number of CPUs.")
+    if err := flags.Parse(args); err != nil {
+        log.Panic(err)
+    }
+    if *seed == 0 {
+        *seed = time.Now().UnixNano()
+    }
+
+    worldMap, err := os.ReadFile(*filename)
+    if err != nil {
+        defer printUsage()
+        log.Panic(err)
+    }
+
+    options := worldx.BatchOptions{Runs: *runs, Aliens: *numberAliens, Workers: *workers, Seed: *seed,
+        Simulation: worldx.SimulationOptions{MaxIterations: *iterations}}
+    result, diagnostics, err := worldx.RunBatch(worldMap, worldx.ReadOptions{}, options)
+    for _, diagnostic := range diagnostics {
+        log.Printf("%s: %v", *filename, diagnostic)
+    }
+    if err != nil {
+        log.Panic(err)
+    }
+
+    printf := func(format string, a ...interface{}) {
+        if _, err := fmt.Fprintf(writer, format, a...); err != nil {
+            log.Panic(err)
+        }
+    }
+    percent := func(n int) float64 {
+        return 100 * float64(n) / float64(result.Runs)
+    }
+
+    printf("%d runs with %d aliens on %s, seed %d\n", result.Runs, result.Aliens, *filename, *seed)
+    printf("Destroyed cities:\n")
+    for destroyed, count := range result.DestroyedCities {
+        if count > 0 {
+            printf("  %d: %d runs (%.1f%%)\n", destroyed, count, percent(count))
+        }
+    }
+
+    cities := make([]string, 0, len(result.CityDestructions))
+    for city := range result.CityDestructions {
+        cities = append(cities, city)
+    }
+    sort.Slice(cities, func(i, j int) bool {
+        ci, cj := result.CityDestructions[cities[i]], result.CityDestructions[cities[j]]
+        return ci > cj || ci == cj && cities[i] < cities[j]
+    })
+    printf("City destructions:\n")
+    for _, city := range cities {
+        count := result.CityDestructions[city]
+        printf("  %s: %d runs (%.1f%%)\n", city, count, percent(count))
+    }
+
+    printf("Alien survival rate: %.1f%%\n", 100*result.AlienSurvivalRate())
+    printf("Iterations until quiet: p50 %d, p90 %d, p99 %d, max %d\n", result.QuietPercentile(50),
+        result.QuietPercentile(90), result.QuietPercentile(99), result.QuietPercentile(100))
+
+    if err := writer.Flush(); err != nil {
+        log.Panic(err)
+    }
+}
+
+// Prints the graph metrics of the world map described on the file in the arguments, its components, degree
+// distribution, articulation points, bridges, diameter and most central cities, and the shortest path between the
+// two cities that follow the file if provided.
+func Stats(args []string, writer *bufio.Writer) {
+    if len(args) != 1 && len(args) != 3 {
+        printUsage()
+        os.Exit(2)
+    }
+    world := readWorld(args[0])
+
+    printf := func(format string, a ...interface{}) {
+        if _, err := fmt.Fprintf(writer, format, a...); err != nil {
+            log.Panic(err)
+        }
+    }
+    graph := analysis.New(world)
+
+    components := graph.Components()
+    printf("%d cities, %d components\n", len(world.Cities), len(components))
+    for _, component := range components {
+        printf("  %d: %s\n", len(component), strings.Join(component, ", "))
+    }
+
+    printf("Degrees:\n")
+    for degree, count := range graph.DegreeDistribution() {
+        if count > 0 {
+            printf("  %d: %d cities\n", degree, count)
+        }
+    }
+
+    printf("Articulation points: %s\n", strings.Join(graph.ArticulationPoints(), ", "))
+    bridges := make([]string, 0)
+    for _, bridge := range graph.Bridges() {
+        bridges = append(bridges, bridge.From+" - "+bridge.To)
+    }
+    printf("Bridges: %s\n", strings.Join(bridges, ", "))
+
+    if diameter, ok := graph.Diameter(); ok {
+        printf("Diameter: %d (%s)\n", diameter.Length, strings.Join(diameter.Cities, " -> "))
+    } else {
+        printf("Diameter: 0\n")
+    }
+
+    betweenness := graph.Betweenness()
+    cities := graph.Cities()
+    sort.SliceStable(cities, func(i, j int) bool { return betweenness[cities[i]] > betweenness[cities[j]] })
+    if len(cities) > maxCentralCities {
+        cities = cities[:maxCentralCities]
+    }
+    printf("Betweenness centrality:\n")
+    for _, city := range cities {
+        printf("  %s: %.1f\n", city, betweenness[city])
+    }
+
+    if len(args) == 3 {
+        if path, ok := graph.ShortestPath(args[1], args[2]); ok {
+            printf("Shortest path: %d (%s)\n", path.Length, strings.Join(path.Cities, " -> "))
+        } else {
+            printf("Shortest path: none from %s to %s\n", args[1], args[2])
+        }
+    }
+
+    if err := writer.Flush(); err != nil {
+        log.Panic(err)
+    }
+}
@@ -0,0 +1,363 @@
+// Package analysis computes graph metrics of the map of a world: connected components, degrees, the cities and roads
+// whose loss splits the map, shortest paths, the diameter and the betweenness centrality of the cities.
+package analysis
+
+import (
+    "container/heap"
+    "sort"
+
+    "github.com/tomasnunes/invasion/pkg/worldx"
+)
+
+// Graph of the cities of a world and the roads and portals between them, built once to compute its metrics. Changes
+// to the world after the graph is built aren't seen by it.
+type Graph struct {
+    names      []string       // Names of the cities, sorted
+    index      map[string]int // Maps the name of a city to its index in names
+    arcs       [][]arc        // Roads leaving each city, the shortest one to each destination
+    neighbours [][]int        // Cities connected to each city by a road in any direction, sorted
+    links      map[link]int   // Number of distinct roads and portals between two cities
+}
+
+type arc struct {
+    to     int
+    length int
+}
+
+// Pair of cities, the lower index first.
+type link struct {
+    a, b int
+}
+
+func newLink(a int, b int) link {
+    if a > b {
+        a, b = b, a
+    }
+    return link{a, b}
+}
+
+// Connection between two cities, with the names sorted.
+type Link struct {
+    From string
+    To   string
+}
+
+// Path between two cities.
+type Path struct {
+    Cities []string // Cities of the path in order, from the origin to the destination
+    Length int      // Iterations aliens take to travel the path
+}
+
+// Builds the graph of the cities of the world.
+func New(w *worldx.WorldX) *Graph {
+    g := &Graph{index: make(map[string]int, len(w.Cities)), links: make(map[link]int)}
+    for name := range w.Cities {
+        g.names = append(g.names, name)
+    }
+    sort.Strings(g.names)
+    for i, name := range g.names {
+        g.index[name] = i
+    }
+
+    g.arcs, g.neighbours = make([][]arc, len(g.names)), make([][]int, len(g.names))
+    connected := make([]map[int]bool, len(g.names))
+    for i := range connected {
+        connected[i] = make(map[int]bool)
+    }
+    for i, name := range g.names {
+        city := w.Cities[name]
+        lengths := make(map[int]int)
+        for _, road := range city.Roads() {
+            to, ok := g.index[road.Destination.Name()]
+            if !ok || to == i {
+                continue
+            }
+            if length, ok := lengths[to]; !ok || road.Length < length {
+                lengths[to] = road.Length
+            }
+            connected[i][to], connected[to][i] = true, true
+
+            // A bidirectional road and a portal are listed by both cities, but are a single connection
+            reverse := road.Portal || road.Destination.Connection(road.Direction.GetOpposite()) == city
+            if !reverse || i < to {
+                g.links[newLink(i, to)]++
+            }
+        }
+        for to, length := range lengths {
+            g.arcs[i] = append(g.arcs[i], arc{to, length})
+        }
+        sort.Slice(g.arcs[i], func(a, b int) bool { return g.arcs[i][a].to < g.arcs[i][b].to })
+    }
+    for i := range connected {
+        for to := range connected[i] {
+            g.neighbours[i] = append(g.neighbours[i], to)
+        }
+        sort.Ints(g.neighbours[i])
+    }
+    return g
+}
+
+// Returns the names of the cities of the graph, sorted.
+func (g *Graph) Cities() []string {
+    return append([]string(nil), g.names...)
+}
+
+// Returns the groups of cities connected to each other ignoring the direction of the roads, largest first, each one
+// sorted by name.
+func (g *Graph) Components() (components [][]string) {
+    visited := make([]bool, len(g.names))
+    for start := range g.names {
+        if visited[start] {
+            continue
+        }
+        var component []string
+        stack := []int{start}
+        visited[start] = true
+        for len(stack) > 0 {
+            city := stack[len(stack)-1]
+            stack = stack[:len(stack)-1]
+            component = append(component, g.names[city])
+            for _, neighbour := range g.neighbours[city] {
+                if !visited[neighbour] {
+                    visited[neighbour] = true
+                    stack = append(stack, neighbour)
+                }
+            }
+        }
+        sort.Strings(component)
+        components = append(components, component)
+    }
+    sort.SliceStable(components, func(i, j int) bool { return len(components[i]) > len(components[j]) })
+    return
+}
+
+// Returns the number of cities with each degree, indexed by degree, the number of cities a city is connected to by
+// roads or portals in any direction.
+func (g *Graph) DegreeDistribution() []int {
+    var distribution []int
+    for _, neighbours := range g.neighbours {
+        for len(distribution) <= len(neighbours) {
+            distribution = append(distribution, 0)
+        }
+        distribution[len(neighbours)]++
+    }
+    return distribution
+}
+
+// Returns the articulation points and bridges of the graph ignoring the direction of the roads, the cities and the
+// connections whose loss splits the map in more components, sorted by name.
+func (g *Graph) cutsets() (points []string, bridges []Link) {
+    // City being explored by the depth-first search, the search keeps its own stack so long paths can't overflow the
+    // stack of the goroutine
+    type frame struct {
+        city     int
+        parent   int
+        next     int // Index of the next neighbour of the city to explore
+        children int
+        isPoint  bool
+    }
+
+    discovered, low := make([]int, len(g.names)), make([]int, len(g.names))
+    time := 0
+    for root := range g.names {
+        if discovered[root] != 0 {
+            continue
+        }
+        time++
+        discovered[root], low[root] = time, time
+        stack := []frame{{city: root, parent: -1}}
+
+        for len(stack) > 0 {
+            top := &stack[len(stack)-1]
+            if top.next < len(g.neighbours[top.city]) {
+                neighbour := g.neighbours[top.city][top.next]
+                top.next++
+                if discovered[neighbour] == 0 {
+                    top.children++
+                    time++
+                    discovered[neighbour], low[neighbour] = time, time
+                    stack = append(stack, frame{city: neighbour, parent: top.city})
+                } else if neighbour != top.parent && discovered[neighbour] < low[top.city] {
+                    low[top.city] = discovered[neighbour]
+                }
+                continue
+            }
+
+            // Every neighbour of the city was explored, its parent learns how far back the city reaches
+            done := *top
+            stack = stack[:len(stack)-1]
+            if done.isPoint || done.parent < 0 && done.children > 1 {
+                points = append(points, g.names[done.city])
+            }
+            if done.parent < 0 {
+                continue
+            }
+
+            city, parent := done.city, &stack[len(stack)-1]
+            if low[city] < low[parent.city] {
+                low[parent.city] = low[city]
+            }
+            if parent.parent >= 0 && low[city] >= discovered[parent.city] {
+                parent.isPoint = true
+            }
+            if low[city] > discovered[parent.city] && g.links[newLink(parent.city, city)] == 1 {
+                from, to := g.names[parent.city], g.names[city]
+                if from > to {
+                    from, to = to, from
+                }
+                bridges = append(bridges, Link{from, to})
+            }
+        }
+    }
+
+    sort.Strings(points)
+    sort.Slice(bridges, func(i, j int) bool {
+        return bridges[i].From < bridges[j].From || bridges[i].From == bridges[j].From && bridges[i].To < bridges[j].To
+    })
+    return
+}
+
+// Returns the cities whose destruction splits the map in more components, sorted by name.
+func (g *Graph) ArticulationPoints() []string {
+    points, _ := g.cutsets()
+    return points
+}
+
+// Returns the connections between two cities whose loss splits the map in more components, sorted by name. Cities
+// connected by more than one road or portal have no bridge between them.
+func (g *Graph) Bridges() []Link {
+    _, bridges := g.cutsets()
+    return bridges
+}
+
+// Returns the shortest path aliens can take from a city to another following the direction of the roads and their
+// lengths, and false if there's none.
+func (g *Graph) ShortestPath(from string, to string) (Path, bool) {
+    start, startOk := g.index[from]
+    end, endOk := g.index[to]
+    if !startOk || !endOk {
+        return Path{}, false
+    }
+
+    distances, previous, _ := g.dijkstra(start)
+    if distances[end] < 0 {
+        return Path{}, false
+    }
+    return g.path(previous, start, end, distances[end]), true
+}
+
+// Returns the longest of the shortest paths between two cities connected by roads, and false if no city is
+// connected to another. The first one in the order of the names of the cities is returned if there's more than one.
+func (g *Graph) Diameter() (diameter Path, ok bool) {
+    for start := range g.names {
+        distances, previous, _ := g.dijkstra(start)
+        for end, distance := range distances {
+            if end != start && distance > diameter.Length {
+                diameter, ok = g.path(previous, start, end, distance), true
+            }
+        }
+    }
+    return
+}
+
+// Returns the betweenness centrality of every city, the number of shortest paths between every ordered pair of other
+// cities that go through it, split evenly between the shortest paths of the same pair.
+func (g *Graph) Betweenness() map[string]float64 {
+    centrality := make([]float64, len(g.names))
+    for start := range g.names {
+        _, predecessors, order := g.dijkstra(start)
+        paths := make([]float64, len(g.names))
+        paths[start] = 1
+        for _, city := range order {
+            for _, predecessor := range predecessors[city] {
+                paths[city] += paths[predecessor]
+            }
+        }
+
+        dependency := make([]float64, len(g.names))
+        for i := len(order) - 1; i >= 0; i-- {
+            city := order[i]
+            for _, predecessor := range predecessors[city] {
+                dependency[predecessor] += paths[predecessor] / paths[city] * (1 + dependency[city])
+            }
+            if city != start {
+                centrality[city] += dependency[city]
+            }
+        }
+    }
+
+    betweenness := make(map[string]float64, len(g.names))
+    for i, name := range g.names {
+        betweenness[name] = centrality[i]
+    }
+    return betweenness
+}
+
+// Computes the shortest distances from the city to every other, -1 if unreachable, the predecessors of every city in
+// its shortest paths, sorted, and the cities reached in order of distance.
+func (g *Graph) dijkstra(start int) (distances []int, predecessors [][]int, order []int) {
+    distances, predecessors = make([]int, len(g.names)), make([][]int, len(g.names))
+    for i := range distances {
+        distances[i] = -1
+    }
+    distances[start] = 0
+    done := make([]bool, len(g.names))
+    queue := &arcQueue{{start, 0}}
+    for queue.Len() > 0 {
+        next := heap.Pop(queue).(arc)
+        if done[next.to] {
+            continue
+        }
+        done[next.to] = true
+        order = append(order, next.to)
+        for _, road := range g.arcs[next.to] {
+            distance := next.length + road.length
+            if current := distances[road.to]; current < 0 || distance < current {
+                distances[road.to], predecessors[road.to] = distance, []int{next.to}
+                heap.Push(queue, arc{road.to, distance})
+            } else if distance == current && !done[road.to] {
+                predecessors[road.to] = append(predecessors[road.to], next.to)
+            }
+        }
+    }
+    for _, p := range predecessors {
+        sort.Ints(p)
+    }
+    return
+}
+
+// Builds the path to the end from the first predecessors found by dijkstra.
+func (g *Graph) path(predecessors [][]int, start int, end int, length int) Path {
+    path := Path{Length: length}
+    for city := end; ; city = predecessors[city][0] {
+        path.Cities = append(path.Cities, g.names[city])
+        if city == start {
+            break
+        }
+    }
+    for i, j := 0, len(path.Cities)-1; i < j; i, j = i+1, j-1 {
+        path.Cities[i], path.Cities[j] = path.Cities[j], path.Cities[i]
+    }
+    return path
+}
+
+// Priority queue of the cities to visit by dijkstra, the length of an arc being the distance to its city. Ties are
+// broken by the index of the city so the paths found don't change between runs.
+type arcQueue []arc
+
+func (q arcQueue) Len() int { return len(q) }
+
+func (q arcQueue) Less(i, j int) bool {
+    return q[i].length < q[j].length || q[i].length == q[j].length && q[i].to < q[j].to
+}
+
+func (q arcQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *arcQueue) Push(x interface{}) { *q = append(*q, x.(arc)) }
+
+func (q *arcQueue) Pop() interface{} {
+    old := *q
+    x := old[len(old)-1]
+    *q = old[:len(old)-1]
+    return x
+}
@@ -0,0 +1,72 @@
+package analysis_test
+
+import (
+    "reflect"
+    "runtime/debug"
+    "strconv"
+    "strings"
+    "testing"
+
+    "github.com/tomasnunes/invasion/pkg/worldx"
+    "github.com/tomasnunes/invasion/pkg/worldx/analysis"
+)
+
+func TestGraph(t *testing.T) {
+    // Two triangles joined by the road C-D, with a road of length 3, a portal and a city on its own
+    testWorld := worldx.WorldX{}
+    testWorld.ReadWorldMap(strings.NewReader(
+        "A east=B portal=C\nB south=C:3\nC east=D\nD east=E portal=F\nE south=F portal=G\nF portal=G\nH\n"))
+    graph := analysis.New(&testWorld)
+
+    expectedComponents := [][]string{{"A", "B", "C", "D", "E", "F", "G"}, {"H"}}
+    if components := graph.Components(); !reflect.DeepEqual(components, expectedComponents) {
+        t.Errorf("Components should be %v, got %v", expectedComponents, components)
+    }
+    if degrees := graph.DegreeDistribution(); !reflect.DeepEqual(degrees, []int{1, 0, 3, 4}) {
+        t.Errorf("Degree distribution should be [1 0 3 4], got %v", degrees)
+    }
+    if points := graph.ArticulationPoints(); !reflect.DeepEqual(points, []string{"C", "D"}) {
+        t.Errorf("Articulation points should be [C D], got %v", points)
+    }
+    if bridges := graph.Bridges(); !reflect.DeepEqual(bridges, []analysis.Link{{"C", "D"}}) {
+        t.Errorf("The only bridge should be C-D, got %v", bridges)
+    }
+
+    if path, ok := graph.ShortestPath("B", "G"); !ok || path.Length != 5 ||
+        !reflect.DeepEqual(path.Cities, []string{"B", "A", "C", "D", "E", "G"}) {
+        t.Errorf("Shortest path from B to G should go around the long road, got %+v", path)
+    }
+    if _, ok := graph.ShortestPath("A", "H"); ok {
+        t.Error("There should be no path to an isolated city")
+    }
+    if diameter, ok := graph.Diameter(); !ok || diameter.Length != 5 || diameter.Cities[0] != "B" || diameter.Cities[5] != "G" {
+        t.Errorf("Diameter should be the path of length 5 from B, got %+v", diameter)
+    }
+
+    betweenness := graph.Betweenness()
+    if betweenness["C"] <= betweenness["A"] || betweenness["D"] <= betweenness["A"] || betweenness["H"] != 0 {
+        t.Errorf("Cities joining the triangles should be the most central: %v", betweenness)
+    }
+}
+
+func TestCutsetsOfLongChain(t *testing.T) {
+    // The search doesn't recurse along the roads, a long chain fits in a small stack
+    defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+
+    world := worldx.WorldX{}
+    previous := world.CreateCity("0")
+    const length = 100000
+    for i := 1; i < length; i++ {
+        city := world.CreateCity(strconv.Itoa(i))
+        world.AddConnection(previous, city, worldx.East)
+        previous = city
+    }
+
+    graph := analysis.New(&world)
+    if points := graph.ArticulationPoints(); len(points) != length-2 {
+        t.Errorf("Every city but the ends of the chain should be an articulation point, got %d", len(points))
+    }
+    if bridges := graph.Bridges(); len(bridges) != length-1 {
+        t.Errorf("Every road of the chain should be a bridge, got %d", len(bridges))
+    }
+}
@@ -0,0 +1,242 @@
+package worldx
+
+import "strings"
+
+// Comments and directives of a world map, kept by the reader so the map can be written back with them, see String.
+type mapAnnotations struct {
+    header       []string            // Comments and directives before the cities, "" where blank lines separated them
+    directions   []Direction         // Directions of the world after the directives of the header, nil if it has none
+    cityComments map[string][]string // Comment lines right before the lines of each city
+    lineComments map[string][]string // Comments at the end of the lines of each city
+    regions      []regionLine        // `%region` directives, written after the cities
+    trailer      []string            // Comment lines after the last city or directive
+}
+
+// A `%region` directive of a world map with its comments.
+type regionLine struct {
+    comments []string // Comment lines right before the directive
+    region   string
+    cities   []string
+    comment  string // Comment at the end of the directive
+}
+
+// Returns the annotations of the world, creating them if it has none.
+func (w *WorldX) mapAnnotations() *mapAnnotations {
+    if w.annotations == nil {
+        w.annotations = &mapAnnotations{}
+    }
+    return w.annotations
+}
+
+// Keeps a comment line of the map, or a blank line if the comment is empty. Comments are attached to the next line
+// of the map, comments before the cities separated from them by a blank line are part of the header.
+func (r *mapReader) readComment(comment string) {
+    if comment != "" {
+        r.comments = append(r.comments, comment)
+        return
+    } else if r.readCities || !r.readContent && len(r.comments) == 0 {
+        return
+    }
+
+    a := r.world.mapAnnotations()
+    a.header, r.comments = append(a.header, r.comments...), nil
+    if len(a.header) > 0 && a.header[len(a.header)-1] != "" {
+        a.header = append(a.header, "")
+    }
+}
+
+// Keeps a directive line of the map with the comments before it, `%region` directives are kept apart since they're
+// written after the cities.
+func (r *mapReader) annotateDirective(line string, fields []mapField, comment string) {
+    a := r.world.mapAnnotations()
+    if strings.TrimPrefix(fields[0].value, directivePrefix) == regionDirective {
+        region := regionLine{comments: r.comments, region: fields[1].value, comment: comment}
+        for _, field := range fields[2:] {
+            region.cities = append(region.cities, field.value)
+        }
+        a.regions, r.comments = append(a.regions, region), nil
+        return
+    }
+
+    a.header, r.comments = append(append(a.header, r.comments...), strings.TrimSpace(line)), nil
+    a.directions = r.world.Directions()
+}
+
+// Attaches the comments before the line of the city and the comment at its end to the city.
+func (r *mapReader) annotateCity(name string, comment string) {
+    if len(r.comments) == 0 && comment == "" {
+        return
+    }
+
+    a := r.world.mapAnnotations()
+    if len(r.comments) > 0 {
+        if a.cityComments == nil {
+            a.cityComments = make(map[string][]string)
+        }
+        a.cityComments[name], r.comments = append(a.cityComments[name], r.comments...), nil
+    }
+    if comment != "" {
+        if a.lineComments == nil {
+            a.lineComments = make(map[string][]string)
+        }
+        a.lineComments[name] = append(a.lineComments[name], comment)
+    }
+}
+
+// Keeps the comments left at the end of the map.
+func (r *mapReader) annotateEnd() {
+    if len(r.comments) > 0 {
+        a := r.world.mapAnnotations()
+        a.trailer, r.comments = append(a.trailer, r.comments...), nil
+    }
+}
+
+// Returns the lines written before the cities, the header as it was read if the world still has the directions it
+// declared, or the directives of its directions and the comments of the header otherwise.
+func (a *mapAnnotations) headerLines(w *WorldX) []string {
+    if a.directions != nil && equalDirections(a.directions, w.Directions()) {
+        return a.header
+    }
+
+    var lines []string
+    if header := w.mapHeader(); header != "" {
+        lines = strings.Split(strings.TrimSuffix(header, "\n"), "\n")
+    }
+    for _, line := range a.header {
+        if !strings.HasPrefix(line, directivePrefix) && (line != "" || len(lines) > 0 && lines[len(lines)-1] != "") {
+            lines = append(lines, line)
+        }
+    }
+    if len(lines) > 0 && strings.HasPrefix(lines[len(lines)-1], commentPrefix) {
+        // A comment right before the first city would be read back as a comment of the city
+        lines = append(lines, "")
+    }
+    return lines
+}
+
+// Returns the `%region` directives with only the cities still in their region, and whether the region of each city
+// is written by them. Directives left without cities aren't returned.
+func (a *mapAnnotations) regionLines(w *WorldX) (regions []regionLine, listed map[string]bool) {
+    listed = make(map[string]bool)
+    for _, region := range a.regions {
+        var cities []string
+        for _, name := range region.cities {
+            if city, ok := w.Cities[name]; ok && city.Region() == region.region {
+                cities, listed[name] = append(cities, name), true
+            }
+        }
+        if len(cities) > 0 || len(region.cities) == 0 {
+            region.cities = cities
+            regions = append(regions, region)
+        }
+    }
+    return
+}
+
+func (r regionLine) String() string {
+    line := directivePrefix + regionDirective + " " + formatName(r.region)
+    for _, city := range r.cities {
+        line += " " + formatName(city)
+    }
+    if r.comment != "" {
+        line += " " + r.comment
+    }
+    return line
+}
+
+// Moves the comments of the city to its new name, and renames it in the `%region` directives.
+func (a *mapAnnotations) renameCity(oldName string, newName string) {
+    if a == nil {
+        return
+    }
+
+    for _, comments := range []map[string][]string{a.cityComments, a.lineComments} {
+        if lines, ok := comments[oldName]; ok {
+            delete(comments, oldName)
+            comments[newName] = lines
+        }
+    }
+    for _, region := range a.regions {
+        for i, name := range region.cities {
+            if name == oldName {
+                region.cities[i] = newName
+            }
+        }
+    }
+}
+
+// Drops the comments of the city and removes it from the `%region` directives, directives left without cities are
+// dropped too.
+func (a *mapAnnotations) deleteCity(name string) {
+    if a == nil {
+        return
+    }
+
+    delete(a.cityComments, name)
+    delete(a.lineComments, name)
+    regions := a.regions[:0]
+    for _, region := range a.regions {
+        var cities []string
+        for _, city := range region.cities {
+            if city != name {
+                cities = append(cities, city)
+            }
+        }
+        if len(cities) > 0 || len(region.cities) == 0 {
+            region.cities = cities
+            regions = append(regions, region)
+        }
+    }
+    a.regions = regions
+}
+
+// Adds the comments of the cities and the `%region` directives of the other annotations, the header and the comments
+// at the end of the other map are left out.
+func (a *mapAnnotations) merge(other *mapAnnotations) {
+    for name, lines := range other.cityComments {
+        if a.cityComments == nil {
+            a.cityComments = make(map[string][]string)
+        }
+        a.cityComments[name] = append(a.cityComments[name], lines...)
+    }
+    for name, lines := range other.lineComments {
+        if a.lineComments == nil {
+            a.lineComments = make(map[string][]string)
+        }
+        a.lineComments[name] = append(a.lineComments[name], lines...)
+    }
+    a.regions = append(a.regions, other.clone().regions...)
+}
+
+// Returns an independent copy of the annotations.
+func (a *mapAnnotations) clone() *mapAnnotations {
+    if a == nil {
+        return nil
+    }
+
+    clone := &mapAnnotations{
+        header:       append([]string(nil), a.header...),
+        directions:   append([]Direction(nil), a.directions...),
+        cityComments: copyComments(a.cityComments),
+        lineComments: copyComments(a.lineComments),
+        trailer:      append([]string(nil), a.trailer...),
+    }
+    for _, region := range a.regions {
+        region.comments = append([]string(nil), region.comments...)
+        region.cities = append([]string(nil), region.cities...)
+        clone.regions = append(clone.regions, region)
+    }
+    return clone
+}
+
+func copyComments(comments map[string][]string) map[string][]string {
+    if comments == nil {
+        return nil
+    }
+
+    clone := make(map[string][]string, len(comments))
+    for name, lines := range comments {
+        clone[name] = append([]string(nil), lines...)
+    }
+    return clone
+}
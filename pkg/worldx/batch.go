@@ -0,0 +1,146 @@
+package worldx
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "io"
+    "runtime"
+    "sort"
+    "sync"
+)
+
+// Options of a batch of independent simulations of the same world map.
+type BatchOptions struct {
+    Runs       int               // Simulations to run
+    Aliens     int               // Aliens generated in every simulation
+    Workers    int               // Simulations running at the same time, 0 for the number of CPUs
+    Seed       int64             // Seed the seed of every simulation is derived from
+    Simulation SimulationOptions // Options of every simulation, their Seed and OnEvent are ignored
+}
+
+// Aggregate statistics of a batch of simulations.
+type BatchResult struct {
+    Runs             int
+    Aliens           int            // Aliens generated in every simulation
+    DestroyedCities  []int          // Simulations that ended with each number of destroyed cities, indexed by it
+    CityDestructions map[string]int // Simulations that destroyed each city
+    SurvivingAliens  int            // Aliens alive at the end of all the simulations
+    QuietIterations  []int          // Iterations each simulation ran until it went quiet or ended, sorted
+}
+
+// Result of one simulation of the batch.
+type runResult struct {
+    destroyedCities []string
+    survivingAliens int
+    quietIteration  int // Iterations the simulation ran until it stopped
+}
+
+// Runs a batch of simulations of the world map, each on a fresh clone of the world read from the map with its own
+// seed derived from options.Seed, spread across options.Workers goroutines. Returns the diagnostics of the map and an
+// error if it can't be read, see ReadWorldMapWithOptions.
+func RunBatch(worldMap []byte, readOptions ReadOptions, options BatchOptions) (BatchResult, []Diagnostic, error) {
+    world := WorldX{}
+    diagnostics, err := world.ReadWorldMapWithOptions(bytes.NewReader(worldMap), readOptions)
+    if err != nil {
+        return BatchResult{}, diagnostics, err
+    } else if options.Runs < 0 || options.Aliens < 0 {
+        return BatchResult{}, diagnostics, fmt.Errorf("RunBatch: runs and aliens can't be negative")
+    } else if options.Aliens > len(world.Cities) {
+        return BatchResult{}, diagnostics, fmt.Errorf(
+            "RunBatch: cannot have more aliens in the world than the number of cities! aliens: %d > cities: %d",
+            options.Aliens, len(world.Cities))
+    }
+
+    workers := options.Workers
+    if workers <= 0 {
+        workers = runtime.NumCPU()
+    }
+
+    runs, results := make(chan int), make(chan runResult)
+    var wg sync.WaitGroup
+    for i := 0; i < workers; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for run := range runs {
+                results <- runBatchSimulation(&world, options, deriveSeed(options.Seed, run))
+            }
+        }()
+    }
+    go func() {
+        for run := 0; run < options.Runs; run++ {
+            runs <- run
+        }
+        close(runs)
+        wg.Wait()
+        close(results)
+    }()
+
+    result := BatchResult{Runs: options.Runs, Aliens: options.Aliens, CityDestructions: make(map[string]int)}
+    for r := range results {
+        for len(result.DestroyedCities) <= len(r.destroyedCities) {
+            result.DestroyedCities = append(result.DestroyedCities, 0)
+        }
+        result.DestroyedCities[len(r.destroyedCities)]++
+        for _, city := range r.destroyedCities {
+            result.CityDestructions[city]++
+        }
+        result.SurvivingAliens += r.survivingAliens
+        result.QuietIterations = append(result.QuietIterations, r.quietIteration)
+    }
+    sort.Ints(result.QuietIterations)
+    return result, diagnostics, nil
+}
+
+// Simulates an invasion of a clone of the world with the seed.
+func runBatchSimulation(base *WorldX, options BatchOptions, seed int64) (r runResult) {
+    world := base.Clone()
+    world.SetSeed(seed)
+    world.GenerateAliens(options.Aliens)
+
+    simulation := options.Simulation
+    simulation.Seed = 0
+    simulation.OnEvent = func(e Event) {
+        if e.Type == CityDestroyed {
+            r.destroyedCities = append(r.destroyedCities, e.City)
+        }
+    }
+    world.RunSimulationWithOptions(bufio.NewWriter(io.Discard), simulation)
+
+    r.survivingAliens, r.quietIteration = len(world.Aliens), world.completedIterations
+    return
+}
+
+// Returns the seed of a simulation of the batch, mixing the seed of the batch and the run so consecutive runs get
+// unrelated seeds.
+func deriveSeed(seed int64, run int) int64 {
+    source := randomSource{state: uint64(seed) + uint64(run)*0x9e3779b97f4a7c15}
+    return int64(source.Uint64())
+}
+
+// Returns the fraction of the generated aliens alive at the end of the simulations.
+func (r BatchResult) AlienSurvivalRate() float64 {
+    if r.Runs == 0 || r.Aliens == 0 {
+        return 0
+    }
+    return float64(r.SurvivingAliens) / float64(r.Runs*r.Aliens)
+}
+
+// Returns the number of iterations until p percent of the simulations went quiet, using the nearest rank.
+func (r BatchResult) QuietPercentile(p float64) int {
+    if len(r.QuietIterations) == 0 {
+        return 0
+    }
+
+    rank := int(p / 100 * float64(len(r.QuietIterations)))
+    if float64(rank) < p/100*float64(len(r.QuietIterations)) {
+        rank++
+    }
+    if rank < 1 {
+        rank = 1
+    } else if rank > len(r.QuietIterations) {
+        rank = len(r.QuietIterations)
+    }
+    return r.QuietIterations[rank-1]
+}
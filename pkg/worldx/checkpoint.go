@@ -0,0 +1,267 @@
+package worldx
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+)
+
+// Version of the checkpoint format written by WriteCheckpoint.
+const CheckpointVersion int = 1
+
+// State of a world in the middle of a simulation, written as JSON. The cities, roads, portals and attributes are kept
+// in the world map format, see WorldX.String.
+type checkpoint struct {
+    Version         int
+    Map             string
+    Damage          map[string]int               `json:",omitempty"` // Damage of the damaged cities
+    Aliens          []alienState                 `json:",omitempty"` // Aliens and defenders
+    Ruins           []ruinState                  `json:",omitempty"`
+    Options         optionsState
+    Iteration       int                          // Iterations the simulation completed
+    Source          *uint64                      `json:",omitempty"` // State of the random source, nil if not seeded
+    DestroyedCities int
+    RebuiltCities   int
+    SavedCities     []string                     `json:",omitempty"`
+    NextAlienID     int
+    Regions         map[string]regionRecordState `json:",omitempty"`
+}
+
+type alienState struct {
+    Name        string
+    Faction     Faction
+    City        string `json:",omitempty"`
+    From        string `json:",omitempty"`
+    To          string `json:",omitempty"`
+    Length      int    `json:",omitempty"`
+    Remaining   int    `json:",omitempty"`
+    Trapped     bool   `json:",omitempty"`
+    Exhausted   bool   `json:",omitempty"`
+    Health      int
+    Energy      int
+    Initialized bool
+    Age         int
+}
+
+type ruinState struct {
+    Name       string
+    Attributes map[string]string `json:",omitempty"`
+    Roads      []ruinedRoadState `json:",omitempty"`
+    RebuildIn  int
+}
+
+type ruinedRoadState struct {
+    Neighbour string
+    Direction string `json:",omitempty"`
+    Length    int    `json:",omitempty"`
+    Incoming  bool   `json:",omitempty"`
+    Portal    bool   `json:",omitempty"`
+}
+
+type regionRecordState struct {
+    InitialCities   int
+    DestroyedCities int
+    FirstFall       int
+}
+
+// Options of the simulation that can be written, strategies and observers are left out.
+type optionsState struct {
+    MaxIterations        int
+    HeadOnCollisions     bool
+    CityDefense          int
+    AlienHealth          int
+    AlienEnergy          int
+    RebuildAfter         int
+    BridgeCollapseChance float64
+    QuarantineChance     float64
+    Seed                 int64
+    DefenseOutcome       DefenseOutcome
+    SpawnEvery           int
+    PopulationCap        int
+    CheckpointEvery      int
+}
+
+// Returns the options of the last simulation of the world, or of the simulation it was checkpointed from.
+func (w *WorldX) Options() SimulationOptions {
+    return w.options
+}
+
+// Writes the full state of the world to the writer, cities, roads, ruins, aliens and defenders, the iteration of the
+// simulation and the state of its random source, so ReadCheckpoint can continue the simulation with the same result.
+// Strategies and observers of the simulation aren't written. See SimulationOptions.OnCheckpoint.
+func (w *WorldX) WriteCheckpoint(writer io.Writer) error {
+    cp := checkpoint{
+        Version:         CheckpointVersion,
+        Map:             w.String(),
+        Iteration:       w.completedIterations,
+        DestroyedCities: w.destroyedCities,
+        RebuiltCities:   w.rebuiltCities,
+        NextAlienID:     w.nextAlienID,
+        Options: optionsState{
+            MaxIterations: w.options.MaxIterations, HeadOnCollisions: w.options.HeadOnCollisions,
+            CityDefense: w.options.CityDefense, AlienHealth: w.options.AlienHealth,
+            AlienEnergy: w.options.AlienEnergy, RebuildAfter: w.options.RebuildAfter,
+            BridgeCollapseChance: w.options.BridgeCollapseChance, QuarantineChance: w.options.QuarantineChance,
+            Seed: w.options.Seed, DefenseOutcome: w.options.DefenseOutcome, SpawnEvery: w.options.SpawnEvery,
+            PopulationCap: w.options.PopulationCap, CheckpointEvery: w.options.CheckpointEvery,
+        },
+    }
+
+    for _, city := range w.Cities {
+        if city.damage > 0 {
+            if cp.Damage == nil {
+                cp.Damage = make(map[string]int)
+            }
+            cp.Damage[city.name] = city.damage
+        }
+    }
+    for _, units := range []map[string]*Alien{w.Aliens, w.Defenders} {
+        for _, a := range sortedUnits(units) {
+            s := alienState{Name: a.name, Faction: a.faction, Trapped: a.isTrapped, Exhausted: a.isExhausted,
+                Health: a.health, Energy: a.energy, Initialized: a.initialized, Age: a.age}
+            if a.location != nil {
+                s.City = a.location.name
+            }
+            if t := a.transit; t != nil {
+                s.From, s.To, s.Length, s.Remaining = t.from.name, t.to.name, t.length, t.remaining
+            }
+            cp.Aliens = append(cp.Aliens, s)
+        }
+    }
+    for _, r := range w.ruins {
+        s := ruinState{Name: r.name, Attributes: r.attributes, RebuildIn: r.rebuildIn}
+        for _, road := range r.roads {
+            roadState := ruinedRoadState{Neighbour: road.neighbour, Length: road.length, Incoming: road.incoming,
+                Portal: road.portal}
+            if !road.portal {
+                roadState.Direction = road.dir.String()
+            }
+            s.Roads = append(s.Roads, roadState)
+        }
+        cp.Ruins = append(cp.Ruins, s)
+    }
+    if w.source != nil {
+        state := w.source.state
+        cp.Source = &state
+    }
+    for name := range w.savedCities {
+        cp.SavedCities = append(cp.SavedCities, name)
+    }
+    sort.Strings(cp.SavedCities)
+    for name, record := range w.regions {
+        if cp.Regions == nil {
+            cp.Regions = make(map[string]regionRecordState)
+        }
+        cp.Regions[name] = regionRecordState{InitialCities: record.initialCities,
+            DestroyedCities: record.destroyedCities, FirstFall: record.firstFall}
+    }
+
+    encoder := json.NewEncoder(writer)
+    encoder.SetIndent("", "  ")
+    return encoder.Encode(cp)
+}
+
+// Reads a world written by WriteCheckpoint, its next simulation continues from the iteration after the checkpoint.
+// Aliens use the strategies of the simulation since their own aren't written.
+func ReadCheckpoint(reader io.Reader) (*WorldX, error) {
+    var cp checkpoint
+    if err := json.NewDecoder(reader).Decode(&cp); err != nil {
+        return nil, fmt.Errorf("ReadCheckpoint: %w", err)
+    } else if cp.Version < 1 || cp.Version > CheckpointVersion {
+        return nil, fmt.Errorf("ReadCheckpoint: unsupported checkpoint version %d, highest supported is %d",
+            cp.Version, CheckpointVersion)
+    }
+
+    w := &WorldX{}
+    if _, err := w.ReadWorldMapWithOptions(strings.NewReader(cp.Map), ReadOptions{}); err != nil {
+        return nil, fmt.Errorf("ReadCheckpoint: %w", err)
+    }
+    if w.Cities == nil {
+        w.Cities = make(map[string]*City)
+    }
+
+    for name, damage := range cp.Damage {
+        city, ok := w.Cities[name]
+        if !ok {
+            return nil, fmt.Errorf("ReadCheckpoint: damaged city %s isn't in the map", formatName(name))
+        }
+        city.damage = damage
+    }
+
+    // Cities aliens are travelling from or to may have been destroyed, they're kept out of the world
+    detached := make(map[string]*City)
+    getCity := func(name string) *City {
+        if city, ok := w.Cities[name]; ok {
+            return city
+        } else if _, ok := detached[name]; !ok {
+            detached[name] = &City{name: name}
+        }
+        return detached[name]
+    }
+
+    for _, s := range cp.Aliens {
+        a := &Alien{name: s.Name, faction: s.Faction, isTrapped: s.Trapped, isExhausted: s.Exhausted,
+            health: s.Health, energy: s.Energy, initialized: s.Initialized, age: s.Age}
+        if s.City != "" {
+            city, ok := w.Cities[s.City]
+            if !ok || city.alien != nil {
+                return nil, fmt.Errorf("ReadCheckpoint: %v %s can't be in %s", s.Faction, s.Name, formatName(s.City))
+            }
+            a.location, city.alien = city, a
+        } else if s.From != "" && s.To != "" {
+            a.transit = &transit{from: getCity(s.From), to: getCity(s.To), length: s.Length, remaining: s.Remaining}
+        }
+
+        if a.faction == DefenderFaction && w.Defenders == nil {
+            w.Defenders = make(map[string]*Alien)
+        } else if a.faction != DefenderFaction && w.Aliens == nil {
+            w.Aliens = make(map[string]*Alien)
+        }
+        w.units(a.faction)[a.name] = a
+    }
+
+    for _, s := range cp.Ruins {
+        r := &ruin{name: s.Name, attributes: s.Attributes, rebuildIn: s.RebuildIn}
+        for _, roadState := range s.Roads {
+            road := ruinedRoad{neighbour: roadState.Neighbour, length: roadState.Length,
+                incoming: roadState.Incoming, portal: roadState.Portal}
+            if !road.portal {
+                if road.dir = w.GetDirection(roadState.Direction); !road.dir.IsValid() {
+                    return nil, fmt.Errorf("ReadCheckpoint: unknown direction %q of ruin %s", roadState.Direction,
+                        formatName(s.Name))
+                }
+            }
+            r.roads = append(r.roads, road)
+        }
+        w.ruins = append(w.ruins, r)
+    }
+
+    o := cp.Options
+    w.options = SimulationOptions{MaxIterations: o.MaxIterations, HeadOnCollisions: o.HeadOnCollisions,
+        CityDefense: o.CityDefense, AlienHealth: o.AlienHealth, AlienEnergy: o.AlienEnergy,
+        RebuildAfter: o.RebuildAfter, BridgeCollapseChance: o.BridgeCollapseChance,
+        QuarantineChance: o.QuarantineChance, Seed: o.Seed, DefenseOutcome: o.DefenseOutcome,
+        SpawnEvery: o.SpawnEvery, PopulationCap: o.PopulationCap, CheckpointEvery: o.CheckpointEvery}
+    w.completedIterations, w.iteration, w.resumed = cp.Iteration, cp.Iteration, true
+    if cp.Source != nil {
+        w.SetSeed(0)
+        w.source.state = *cp.Source
+    }
+    w.destroyedCities, w.rebuiltCities, w.nextAlienID = cp.DestroyedCities, cp.RebuiltCities, cp.NextAlienID
+    for _, name := range cp.SavedCities {
+        if w.savedCities == nil {
+            w.savedCities = make(map[string]bool)
+        }
+        w.savedCities[name] = true
+    }
+    for name, record := range cp.Regions {
+        if w.regions == nil {
+            w.regions = make(map[string]*regionRecord)
+        }
+        w.regions[name] = &regionRecord{initialCities: record.InitialCities,
+            destroyedCities: record.DestroyedCities, firstFall: record.FirstFall}
+    }
+    return w, nil
+}
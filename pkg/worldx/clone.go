@@ -0,0 +1,192 @@
+package worldx
+
+// Copies the pointers of a world into the clone, copying every city and alien only once. Every city and alien the world
+// reaches is copied first and their pointers are remapped to the copies after, so maps with long paths can't overflow
+// the stack.
+type cloner struct {
+    cities  map[*City]*City
+    aliens  map[*Alien]*Alien
+    pending []*City // Copied cities whose neighbours may not be copied yet
+}
+
+func (w *WorldX) Clone() *WorldX {
+    c := cloner{cities: make(map[*City]*City, len(w.Cities)), aliens: make(map[*Alien]*Alien, len(w.Aliens))}
+    c.copyAll(w)
+    c.remap()
+    clone := &WorldX{
+        Cities:              c.cityMap(w.Cities),
+        Aliens:              c.alienMap(w.Aliens),
+        Defenders:           c.alienMap(w.Defenders),
+        options:             w.options,
+        iteration:           w.iteration,
+        completedIterations: w.completedIterations,
+        resumed:             w.resumed,
+        destroyedCities:     w.destroyedCities,
+        rebuiltCities:       w.rebuiltCities,
+        nextAlienID:         w.nextAlienID,
+        annotations:         w.annotations.clone(),
+    }
+
+    if w.directions != nil {
+        clone.directions = append([]Direction(nil), w.directions...)
+    }
+    if w.directionNames != nil {
+        clone.directionNames = make(map[string]Direction, len(w.directionNames))
+        for name, dir := range w.directionNames {
+            clone.directionNames[name] = dir
+        }
+    }
+    for _, r := range w.ruins {
+        clonedRuin := *r
+        clonedRuin.attributes = copyAttributes(r.attributes)
+        clonedRuin.roads = append([]ruinedRoad(nil), r.roads...)
+        clone.ruins = append(clone.ruins, &clonedRuin)
+    }
+    if w.source != nil {
+        clone.source, clone.rng = w.source.clone()
+    }
+    if w.savedCities != nil {
+        clone.savedCities = make(map[string]bool, len(w.savedCities))
+        for name := range w.savedCities {
+            clone.savedCities[name] = true
+        }
+    }
+    if w.regions != nil {
+        clone.regions = make(map[string]*regionRecord, len(w.regions))
+        for name, record := range w.regions {
+            clonedRecord := *record
+            clone.regions[name] = &clonedRecord
+        }
+    }
+    return clone
+}
+
+func (c *cloner) cityMap(cities map[string]*City) map[string]*City {
+    if cities == nil {
+        return nil
+    }
+
+    clones := make(map[string]*City, len(cities))
+    for name, city := range cities {
+        clones[name] = c.cities[city]
+    }
+    return clones
+}
+
+func (c *cloner) alienMap(aliens map[string]*Alien) map[string]*Alien {
+    if aliens == nil {
+        return nil
+    }
+
+    clones := make(map[string]*Alien, len(aliens))
+    for name, alien := range aliens {
+        clones[name] = c.aliens[alien]
+    }
+    return clones
+}
+
+// Copies every city and alien the world reaches, cities that were deleted are copied too if aliens or roads still
+// refer to them.
+func (c *cloner) copyAll(w *WorldX) {
+    for _, city := range w.Cities {
+        c.copyCity(city)
+    }
+    for _, units := range []map[string]*Alien{w.Aliens, w.Defenders} {
+        for _, alien := range units {
+            c.copyAlien(alien)
+        }
+    }
+
+    for len(c.pending) > 0 {
+        city := c.pending[len(c.pending)-1]
+        c.pending = c.pending[:len(c.pending)-1]
+        for _, connection := range city.connectedCities {
+            c.copyCity(connection)
+        }
+        for from := range city.incoming {
+            c.copyCity(from)
+        }
+        for _, portal := range city.portals {
+            c.copyCity(portal)
+        }
+        c.copyAlien(city.alien)
+    }
+}
+
+// Copies the city without its pointers to other cities and aliens, which are remapped once everything is copied.
+func (c *cloner) copyCity(city *City) {
+    if city == nil {
+        return
+    } else if _, ok := c.cities[city]; ok {
+        return
+    }
+
+    c.cities[city] = &City{
+        name:        city.name,
+        roadLengths: append([]int(nil), city.roadLengths...),
+        attributes:  copyAttributes(city.attributes),
+        damage:      city.damage,
+    }
+    c.pending = append(c.pending, city)
+}
+
+// Copies the alien and the cities it's in or travelling between.
+func (c *cloner) copyAlien(alien *Alien) {
+    if alien == nil {
+        return
+    } else if _, ok := c.aliens[alien]; ok {
+        return
+    }
+
+    clone := new(Alien)
+    *clone = *alien
+    c.aliens[alien] = clone
+    c.copyCity(alien.location)
+    if alien.transit != nil {
+        c.copyCity(alien.transit.from)
+        c.copyCity(alien.transit.to)
+    }
+}
+
+// Points the copied cities and aliens to the copies instead of the originals.
+func (c *cloner) remap() {
+    for city, clone := range c.cities {
+        if city.connectedCities != nil {
+            clone.connectedCities = make([]*City, len(city.connectedCities))
+            for dir, connection := range city.connectedCities {
+                clone.connectedCities[dir] = c.cities[connection]
+            }
+        }
+        if city.incoming != nil {
+            clone.incoming = make(map[*City]int, len(city.incoming))
+            for from, count := range city.incoming {
+                clone.incoming[c.cities[from]] = count
+            }
+        }
+        for _, portal := range city.portals {
+            clone.portals = append(clone.portals, c.cities[portal])
+        }
+        clone.alien = c.aliens[city.alien]
+    }
+
+    for alien, clone := range c.aliens {
+        clone.location = c.cities[alien.location]
+        if alien.transit != nil {
+            clonedTransit := *alien.transit
+            clonedTransit.from, clonedTransit.to = c.cities[alien.transit.from], c.cities[alien.transit.to]
+            clone.transit = &clonedTransit
+        }
+    }
+}
+
+func copyAttributes(attributes map[string]string) map[string]string {
+    if attributes == nil {
+        return nil
+    }
+
+    clone := make(map[string]string, len(attributes))
+    for key, value := range attributes {
+        clone[key] = value
+    }
+    return clone
+}
@@ -0,0 +1,122 @@
+package worldx
+
+import (
+    "bufio"
+    "log"
+    "math/rand"
+)
+
+// Side an alien fights for, invaders destroy cities and defenders hunt invaders.
+type Faction int
+
+const (
+    InvaderFaction  Faction = iota // Aliens invading the world, the default
+    DefenderFaction                // Human defenders, stop invaders without destroying cities
+)
+
+func (f Faction) String() string {
+    if f == DefenderFaction {
+        return "defender"
+    }
+    return "alien"
+}
+
+// Outcome of an invader meeting a defender in a city, the city is never destroyed.
+type DefenseOutcome int
+
+const (
+    InvaderKilled  DefenseOutcome = iota // The invader dies and the defender survives, the default
+    BothKilled                           // The invader and the defender die
+    DefenderKilled                       // The defender dies and the invader survives
+)
+
+// If defender doesn't exist, creates it in a random empty city and adds it to the world, see CreateAlien.
+// Defenders are aliens of the DefenderFaction, they don't fight each other and kill the invaders they meet in a
+// city, or as set by SimulationOptions.DefenseOutcome. Panics if an invader already has the name.
+// Returns pointer to defender with requested name.
+func (w *WorldX) CreateDefender(defenderName string, possibleEmptyCities []string) *Alien {
+    if w.Defenders == nil {
+        w.Defenders = make(map[string]*Alien)
+    }
+
+    if _, ok := w.Aliens[defenderName]; ok {
+        log.Panicf("CreateDefender: there's already an alien named %s.", defenderName)
+    } else if d, ok := w.Defenders[defenderName]; ok {
+        return d
+    }
+
+    randomEmptyCity := w.getRandomEmptyCity(possibleEmptyCities)
+    newDefender := Alien{
+        name:        defenderName,
+        location:    randomEmptyCity,
+        isTrapped:   randomEmptyCity.IsIsolated(),
+        health:      1,
+        energy:      UnlimitedEnergy,
+        initialized: true,
+        faction:     DefenderFaction,
+    }
+    w.Defenders[defenderName] = &newDefender
+    w.reserveAlienName(defenderName)
+    randomEmptyCity.alien = &newDefender
+    return &newDefender
+}
+
+// Returns the aliens of the faction in the world.
+func (w *WorldX) units(faction Faction) map[string]*Alien {
+    if faction == DefenderFaction {
+        return w.Defenders
+    }
+    return w.Aliens
+}
+
+// Returns every alien of the world, invaders and defenders, in no particular order.
+func (w *WorldX) allUnits() []*Alien {
+    units := make([]*Alien, 0, len(w.Aliens)+len(w.Defenders))
+    for _, a := range w.Aliens {
+        units = append(units, a)
+    }
+    for _, d := range w.Defenders {
+        units = append(units, d)
+    }
+    return units
+}
+
+// The invader and the defender meet in the city, whoever arrived, and the losers of options.DefenseOutcome die.
+// The city is saved, and the winner stays in it or takes its place if the loser was there.
+func (w *WorldX) defend(city *City, arriving *Alien, writer *bufio.Writer) {
+    invader, defender := arriving, city.alien
+    if invader.faction == DefenderFaction {
+        invader, defender = defender, invader
+    }
+
+    outcome := w.options.DefenseOutcome
+    w.emit(writer, Event{Type: CityDefended, City: city.name, Aliens: []string{invader.name, defender.name},
+        Outcome: outcome})
+    if w.savedCities == nil {
+        w.savedCities = make(map[string]bool)
+    }
+    w.savedCities[city.name] = true
+
+    if outcome == InvaderKilled || outcome == BothKilled {
+        w.deleteAlien(invader)
+    }
+    if outcome == DefenderKilled || outcome == BothKilled {
+        w.deleteAlien(defender)
+    }
+    if w.units(arriving.faction)[arriving.name] == arriving {
+        w.arriveAlien(arriving, city, writer)
+    }
+}
+
+// Moves defenders towards invaders in neighbouring cities, or through a random road if there are none,
+// the default strategy of defenders.
+type HuntingStrategy struct{}
+
+func (HuntingStrategy) NextMove(_ *Alien, roads []Road, rng *rand.Rand) int {
+    for i, road := range roads {
+        if a := road.Destination.alien; a != nil && a.faction == InvaderFaction {
+            return i
+        }
+    }
+    return rng.Intn(len(roads))
+}
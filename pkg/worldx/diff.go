@@ -0,0 +1,366 @@
+package worldx
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Lines of context around the changes of a unified diff.
+const diffContextLines int = 3
+
+// Colors of the unified diff in a terminal.
+const (
+    colorReset = "\x1b[0m"
+    colorBold  = "\x1b[1m"
+    colorRed   = "\x1b[31m"
+    colorGreen = "\x1b[32m"
+    colorCyan  = "\x1b[36m"
+)
+
+// Changes of a world between two states, e.g. before and after a simulation, see Diff.
+type WorldDiff struct {
+    RemovedCities   []string         // Cities before that aren't in the world after, sorted
+    AddedCities     []string         // Cities after that weren't in the world before, e.g. rebuilt ones, sorted
+    RemovedRoads    []DiffRoad       // Roads and portals before that aren't in the world after
+    AddedRoads      []DiffRoad       // Roads and portals after that weren't in the world before
+    IsolatedCities  []string         // Cities after that are isolated but weren't before, sorted
+    SplitComponents []ComponentSplit // Components of connected cities before that are split after
+    lines           []diffLine       // Lines of the world maps, merged by city
+}
+
+// Road or portal of a world diff, portals are only listed once from the city with the lowest name.
+type DiffRoad struct {
+    From      string
+    Direction string `json:",omitempty"` // Empty for portals
+    To        string
+    Portal    bool   `json:",omitempty"`
+}
+
+// Component of connected cities, ignoring the direction of the roads, split in more components.
+type ComponentSplit struct {
+    Before []string   // Cities of the component before, sorted
+    After  [][]string // Components the cities left of it are split in, largest first, each one sorted
+}
+
+// Line of a unified diff, op is ' ' for lines of both worlds, '-' for lines before and '+' for lines after.
+type diffLine struct {
+    op   byte
+    text string
+}
+
+// Returns the changes of the world after, e.g. after a simulation, compared to the world before, by city name.
+func Diff(before *WorldX, after *WorldX) (diff WorldDiff) {
+    for _, city := range before.sortedCities() {
+        if _, ok := after.Cities[city.name]; !ok {
+            diff.RemovedCities = append(diff.RemovedCities, city.name)
+        } else if after.Cities[city.name].IsIsolated() && !city.IsIsolated() {
+            diff.IsolatedCities = append(diff.IsolatedCities, city.name)
+        }
+    }
+    for _, city := range after.sortedCities() {
+        if _, ok := before.Cities[city.name]; !ok {
+            diff.AddedCities = append(diff.AddedCities, city.name)
+        }
+    }
+
+    beforeRoads, afterRoads := before.diffRoads(), after.diffRoads()
+    for _, road := range beforeRoads {
+        if !containsDiffRoad(afterRoads, road) {
+            diff.RemovedRoads = append(diff.RemovedRoads, road)
+        }
+    }
+    for _, road := range afterRoads {
+        if !containsDiffRoad(beforeRoads, road) {
+            diff.AddedRoads = append(diff.AddedRoads, road)
+        }
+    }
+
+    afterComponents := after.componentIndexes()
+    for _, component := range before.components() {
+        groups := make(map[int][]string)
+        for _, name := range component {
+            if _, ok := after.Cities[name]; ok {
+                groups[afterComponents[name]] = append(groups[afterComponents[name]], name)
+            }
+        }
+        if len(groups) < 2 {
+            continue
+        }
+
+        split := ComponentSplit{Before: component}
+        for _, group := range groups {
+            split.After = append(split.After, group)
+        }
+        sort.Slice(split.After, func(i, j int) bool {
+            return len(split.After[i]) > len(split.After[j]) ||
+                len(split.After[i]) == len(split.After[j]) && split.After[i][0] < split.After[j][0]
+        })
+        diff.SplitComponents = append(diff.SplitComponents, split)
+    }
+
+    diff.lines = diffLines(before, after)
+    return
+}
+
+// Returns the roads and portals of the world, ordered by city and then as listed by City.Roads.
+func (w *WorldX) diffRoads() (roads []DiffRoad) {
+    for _, city := range w.sortedCities() {
+        for _, road := range city.Roads() {
+            if !road.Portal {
+                roads = append(roads, DiffRoad{From: city.name, Direction: road.Direction.String(),
+                    To: road.Destination.name})
+            } else if city.name < road.Destination.name {
+                roads = append(roads, DiffRoad{From: city.name, To: road.Destination.name, Portal: true})
+            }
+        }
+    }
+    return
+}
+
+func containsDiffRoad(roads []DiffRoad, road DiffRoad) bool {
+    // Roads are ordered by city, only the roads of the same city are compared
+    i := sort.Search(len(roads), func(i int) bool { return roads[i].From >= road.From })
+    for ; i < len(roads) && roads[i].From == road.From; i++ {
+        if roads[i] == road {
+            return true
+        }
+    }
+    return false
+}
+
+// Returns the index of the component of every city, the groups of cities connected ignoring the direction of the
+// roads, numbered in order of their first city.
+func (w *WorldX) componentIndexes() map[string]int {
+    indexes := make(map[string]int, len(w.Cities))
+    component := 0
+    for _, start := range w.sortedCities() {
+        if _, ok := indexes[start.name]; ok {
+            continue
+        }
+
+        indexes[start.name] = component
+        stack := []*City{start}
+        for len(stack) > 0 {
+            city := stack[len(stack)-1]
+            stack = stack[:len(stack)-1]
+            neighbours := make([]*City, 0, len(city.incoming))
+            for neighbour := range city.incoming {
+                neighbours = append(neighbours, neighbour)
+            }
+            for _, road := range city.Roads() {
+                neighbours = append(neighbours, road.Destination)
+            }
+            for _, neighbour := range neighbours {
+                if _, ok := indexes[neighbour.name]; !ok && w.Cities[neighbour.name] == neighbour {
+                    indexes[neighbour.name] = component
+                    stack = append(stack, neighbour)
+                }
+            }
+        }
+        component++
+    }
+    return indexes
+}
+
+// Returns the groups of cities connected ignoring the direction of the roads, in order of their first city, each one
+// sorted.
+func (w *WorldX) components() (components [][]string) {
+    indexes := w.componentIndexes()
+    for _, city := range w.sortedCities() {
+        index := indexes[city.name]
+        for len(components) <= index {
+            components = append(components, nil)
+        }
+        components[index] = append(components[index], city.name)
+    }
+    return
+}
+
+// Returns the lines of both world maps merged by city, the lines of cities that changed are replaced.
+func diffLines(before *WorldX, after *WorldX) (lines []diffLine) {
+    appendLines := func(op byte, text string) {
+        for _, line := range strings.SplitAfter(text, "\n") {
+            if line != "" {
+                lines = append(lines, diffLine{op, strings.TrimSuffix(line, "\n")})
+            }
+        }
+    }
+    if beforeHeader, afterHeader := before.mapHeader(), after.mapHeader(); beforeHeader == afterHeader {
+        appendLines(' ', beforeHeader)
+    } else {
+        appendLines('-', beforeHeader)
+        appendLines('+', afterHeader)
+    }
+
+    beforeCities, afterCities := before.sortedCities(), after.sortedCities()
+    for len(beforeCities) > 0 || len(afterCities) > 0 {
+        switch {
+        case len(afterCities) == 0 || len(beforeCities) > 0 && beforeCities[0].name < afterCities[0].name:
+            appendLines('-', beforeCities[0].String())
+            beforeCities = beforeCities[1:]
+        case len(beforeCities) == 0 || afterCities[0].name < beforeCities[0].name:
+            appendLines('+', afterCities[0].String())
+            afterCities = afterCities[1:]
+        default:
+            if beforeLine, afterLine := beforeCities[0].String(), afterCities[0].String(); beforeLine == afterLine {
+                appendLines(' ', beforeLine)
+            } else {
+                appendLines('-', beforeLine)
+                appendLines('+', afterLine)
+            }
+            beforeCities, afterCities = beforeCities[1:], afterCities[1:]
+        }
+    }
+    return
+}
+
+// Returns true if the worlds of the diff have the same map.
+func (d WorldDiff) IsEmpty() bool {
+    for _, line := range d.lines {
+        if line.op != ' ' {
+            return false
+        }
+    }
+    return true
+}
+
+// Returns the world maps of the diff as a unified diff, with 3 lines of context around the changes, colored for a
+// terminal if color is true. Returns an empty string if the maps are the same.
+func (d WorldDiff) Unified(color bool) string {
+    paint := func(code string, text string) string {
+        if color {
+            return code + text + colorReset
+        }
+        return text
+    }
+
+    // Ranges of lines shown, the changes and their context, merging the ranges that touch
+    var hunks [][2]int
+    for i, line := range d.lines {
+        if line.op == ' ' {
+            continue
+        }
+        start, end := i-diffContextLines, i+diffContextLines+1
+        if start < 0 {
+            start = 0
+        }
+        if end > len(d.lines) {
+            end = len(d.lines)
+        }
+        if last := len(hunks) - 1; last >= 0 && start <= hunks[last][1] {
+            hunks[last][1] = end
+        } else {
+            hunks = append(hunks, [2]int{start, end})
+        }
+    }
+    if len(hunks) == 0 {
+        return ""
+    }
+
+    var b strings.Builder
+    b.WriteString(paint(colorBold, "--- before") + "\n" + paint(colorBold, "+++ after") + "\n")
+    beforeLine, afterLine, next := 1, 1, 0
+    for _, hunk := range hunks {
+        for ; next < hunk[0]; next++ {
+            beforeLine, afterLine = beforeLine+1, afterLine+1
+        }
+
+        var beforeCount, afterCount int
+        for _, line := range d.lines[hunk[0]:hunk[1]] {
+            if line.op != '+' {
+                beforeCount++
+            }
+            if line.op != '-' {
+                afterCount++
+            }
+        }
+        b.WriteString(paint(colorCyan, fmt.Sprintf("@@ -%s +%s @@", hunkRange(beforeLine, beforeCount),
+            hunkRange(afterLine, afterCount))) + "\n")
+
+        for _, line := range d.lines[hunk[0]:hunk[1]] {
+            text := string(line.op) + line.text
+            switch line.op {
+            case '-':
+                text = paint(colorRed, text)
+            case '+':
+                text = paint(colorGreen, text)
+            }
+            b.WriteString(text + "\n")
+        }
+        beforeLine, afterLine, next = beforeLine+beforeCount, afterLine+afterCount, hunk[1]
+    }
+    return b.String()
+}
+
+// Returns the range of lines of a hunk header, the line before the hunk if it has no lines like GNU diff.
+func hunkRange(start int, count int) string {
+    if count == 0 {
+        start--
+    }
+    if count == 1 {
+        return strconv.Itoa(start)
+    }
+    return strconv.Itoa(start) + "," + strconv.Itoa(count)
+}
+
+func (r DiffRoad) String() string {
+    if r.Portal {
+        return formatName(r.From) + " " + portalKey + directionSeparator + formatName(r.To)
+    }
+    return formatName(r.From) + " " + r.Direction + directionSeparator + formatName(r.To)
+}
+
+func (s ComponentSplit) String() string {
+    groups := make([]string, len(s.After))
+    for i, group := range s.After {
+        groups[i] = formatNames(group)
+    }
+    return formatNames(s.Before) + " split in " + strings.Join(groups, " ")
+}
+
+// Returns the list of changes of the diff, one kind per line, or an empty string if there are none.
+func (d WorldDiff) String() (dStr string) {
+    roads := func(roads []DiffRoad) string {
+        names := make([]string, len(roads))
+        for i, road := range roads {
+            names[i] = road.String()
+        }
+        return strings.Join(names, ", ")
+    }
+    splits := make([]string, len(d.SplitComponents))
+    for i, split := range d.SplitComponents {
+        splits[i] = split.String()
+    }
+
+    for _, change := range []struct {
+        title string
+        count int
+        list  string
+    }{
+        {"removed cities", len(d.RemovedCities), strings.Join(formatNameList(d.RemovedCities), ", ")},
+        {"added cities", len(d.AddedCities), strings.Join(formatNameList(d.AddedCities), ", ")},
+        {"removed roads", len(d.RemovedRoads), roads(d.RemovedRoads)},
+        {"added roads", len(d.AddedRoads), roads(d.AddedRoads)},
+        {"isolated cities", len(d.IsolatedCities), strings.Join(formatNameList(d.IsolatedCities), ", ")},
+        {"split components", len(d.SplitComponents), strings.Join(splits, ", ")},
+    } {
+        if change.count > 0 {
+            dStr += fmt.Sprintf("%d %s: %s\n", change.count, change.title, change.list)
+        }
+    }
+    return
+}
+
+func formatNameList(names []string) []string {
+    formatted := make([]string, len(names))
+    for i, name := range names {
+        formatted[i] = formatName(name)
+    }
+    return formatted
+}
+
+func formatNames(names []string) string {
+    return "{" + strings.Join(formatNameList(names), " ") + "}"
+}
@@ -0,0 +1,244 @@
+package worldx
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    "sync"
+    "unicode"
+)
+
+type Direction int
+
+// Built-in directions. MaxDirections follows them and is never a valid direction, the custom directions declared by
+// worlds with WorldX.DeclareDirection take the values after it.
+const (
+    North Direction = iota
+    South
+    East
+    West
+    NorthEast
+    NorthWest
+    SouthEast
+    SouthWest
+    Up
+    Down
+    MaxDirections
+    UnknownDirection = -1
+)
+
+type directionDetails struct {
+    name     string
+    opposite Direction
+}
+
+// Names and opposites of the built-in directions, indexed by Direction.
+var builtinDirections = [MaxDirections]directionDetails{
+    North:     {"north", South},
+    South:     {"south", North},
+    East:      {"east", West},
+    West:      {"west", East},
+    NorthEast: {"northeast", SouthWest},
+    NorthWest: {"northwest", SouthEast},
+    SouthEast: {"southeast", NorthWest},
+    SouthWest: {"southwest", NorthEast},
+    Up:        {"up", Down},
+    Down:      {"down", Up},
+}
+
+// Maps the lower case names of the built-in directions to the direction.
+var builtinDirectionNames = map[string]Direction{
+    "north": North, "south": South, "east": East, "west": West,
+    "northeast": NorthEast, "northwest": NorthWest, "southeast": SouthEast, "southwest": SouthWest,
+    "up": Up, "down": Down,
+}
+
+// Aliases of the built-in directions, only known by the worlds that have the direction, so maps without it can still
+// use the alias as the name of an attribute.
+var defaultDirectionAliases = map[string]Direction{
+    "n": North, "s": South, "e": East, "w": West,
+    "ne": NorthEast, "nw": NorthWest, "se": SouthEast, "sw": SouthWest,
+    "u": Up, "d": Down,
+}
+
+// Custom directions declared by any world, kept by name and opposite so a Direction has the same name and opposite in
+// every world, and worlds can declare the same name with different opposites. Only the worlds that declare a custom
+// direction know it by name.
+var customDirections = struct {
+    sync.RWMutex
+    directions []directionDetails       // Indexed by Direction - MaxDirections - 1
+    values     map[[2]string]Direction // Maps the name and opposite of each custom direction to it
+}{values: make(map[[2]string]Direction)}
+
+// Sets of directions a world map can declare by name with the `%directions` directive.
+var directionPresets = map[string][]Direction{
+    "cardinal":  {North, South, East, West},
+    "eight-way": {North, South, East, West, NorthEast, NorthWest, SouthEast, SouthWest},
+    "hex":       {NorthEast, East, SouthEast, SouthWest, West, NorthWest},
+    "vertical":  {Up, Down},
+}
+
+// Directions of a world that doesn't declare its own.
+var defaultDirections = directionPresets["cardinal"]
+
+// Returns the custom direction with the name and opposite, adding it and its opposite if they don't exist yet.
+// A direction whose opposite has the same name is its own opposite.
+func customDirection(name string, opposite string) Direction {
+    if strings.EqualFold(name, opposite) {
+        opposite = name
+    }
+
+    customDirections.Lock()
+    defer customDirections.Unlock()
+
+    if dir, ok := customDirections.values[[2]string{name, opposite}]; ok {
+        return dir
+    }
+
+    add := func(name string, opposite string) Direction {
+        dir := MaxDirections + 1 + Direction(len(customDirections.directions))
+        customDirections.directions = append(customDirections.directions, directionDetails{name, dir})
+        customDirections.values[[2]string{name, opposite}] = dir
+        return dir
+    }
+    dir := add(name, opposite)
+    if opposite != name {
+        oppositeDir := add(opposite, name)
+        customDirections.directions[dir-MaxDirections-1].opposite = oppositeDir
+        customDirections.directions[oppositeDir-MaxDirections-1].opposite = dir
+    }
+    return dir
+}
+
+// Declares a direction of this world with its opposite and aliases, and adds both to the directions of the world.
+// Names and aliases are matched ignoring case, a name that isn't a built-in direction or already declared by this
+// world declares a custom direction. Declaring a direction again with the same opposite returns it, with another
+// opposite, or with an alias of another direction of the world, returns an error.
+func (w *WorldX) DeclareDirection(name string, opposite string, aliases ...string) (Direction, error) {
+    for _, n := range append([]string{name, opposite}, aliases...) {
+        if !isValidDirectionName(n) {
+            return UnknownDirection, fmt.Errorf("DeclareDirection: invalid direction name %q", n)
+        }
+    }
+
+    dir, oppositeDir := w.GetDirection(name), w.GetDirection(opposite)
+    switch {
+    case dir.IsValid() != oppositeDir.IsValid(), dir.IsValid() && dir.GetOpposite() != oppositeDir:
+        return UnknownDirection, fmt.Errorf("DeclareDirection: %s and %s aren't opposite directions", name, opposite)
+    case !dir.IsValid():
+        dir = customDirection(name, opposite)
+        oppositeDir = dir.GetOpposite()
+    }
+    for _, alias := range aliases {
+        if aliasDir := w.GetDirection(alias); aliasDir.IsValid() && aliasDir != dir {
+            return UnknownDirection, fmt.Errorf("DeclareDirection: alias %s is already used by %v", alias, aliasDir)
+        }
+    }
+
+    if w.directionNames == nil {
+        w.directionNames = make(map[string]Direction)
+    }
+    for _, d := range []Direction{dir, oppositeDir} {
+        if d > MaxDirections {
+            w.directionNames[strings.ToLower(d.String())] = d
+        }
+    }
+    for _, alias := range aliases {
+        w.directionNames[strings.ToLower(alias)] = dir
+    }
+
+    dirs := w.Directions()
+    for _, d := range []Direction{dir, oppositeDir} {
+        if !containsDirection(dirs, d) {
+            dirs = append(dirs, d)
+        }
+    }
+    w.SetDirections(dirs...)
+    return dir, nil
+}
+
+// Returns the direction with the name or alias in this world, ignoring case, either a built-in direction or one
+// declared by the world, or UnknownDirection if there's none. The default aliases of the built-in directions, e.g.
+// `n` for north, are only known if the world has the direction.
+func (w *WorldX) GetDirection(name string) Direction {
+    lowerName := strings.ToLower(name)
+    if dir, ok := w.directionNames[lowerName]; ok {
+        return dir
+    } else if dir, ok := defaultDirectionAliases[lowerName]; ok && w.HasDirection(dir) {
+        return dir
+    }
+    return GetDirection(name)
+}
+
+// Returns the aliases declared by this world for the direction, sorted.
+func (w *WorldX) directionAliases(dir Direction) (aliases []string) {
+    for alias, aliasDir := range w.directionNames {
+        if aliasDir == dir && alias != strings.ToLower(dir.String()) {
+            aliases = append(aliases, alias)
+        }
+    }
+    sort.Strings(aliases)
+    return
+}
+
+// Direction names are made of letters, digits, `-` and `_`, so they can't be mistaken for other parts of a map.
+func isValidDirectionName(name string) bool {
+    if name == "" {
+        return false
+    }
+    for _, r := range name {
+        if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' {
+            return false
+        }
+    }
+    return true
+}
+
+// Returns the directions of a set declared by name, e.g. "hex", or nil if there's no set with that name.
+func getDirectionPreset(name string) []Direction {
+    return directionPresets[strings.ToLower(name)]
+}
+
+// Returns the built-in direction with the name, ignoring case, or UnknownDirection if there's none.
+// Custom directions and aliases are only known by the worlds that have them, see WorldX.GetDirection.
+func GetDirection(dir string) Direction {
+    if d, ok := builtinDirectionNames[strings.ToLower(dir)]; ok {
+        return d
+    }
+    return UnknownDirection
+}
+
+func (d Direction) String() string {
+    if details, ok := d.details(); ok {
+        return details.name
+    }
+    return "unknown"
+}
+
+func (d Direction) IsValid() bool {
+    _, ok := d.details()
+    return ok
+}
+
+func (d Direction) GetOpposite() Direction {
+    if details, ok := d.details(); ok {
+        return details.opposite
+    }
+    return UnknownDirection
+}
+
+func (d Direction) details() (directionDetails, bool) {
+    if d >= 0 && d < MaxDirections {
+        return builtinDirections[d], true
+    } else if d <= MaxDirections {
+        return directionDetails{}, false
+    }
+
+    customDirections.RLock()
+    defer customDirections.RUnlock()
+
+    if i := int(d - MaxDirections - 1); i < len(customDirections.directions) {
+        return customDirections.directions[i], true
+    }
+    return directionDetails{}, false
+}
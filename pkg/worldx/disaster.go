@@ -0,0 +1,98 @@
+package worldx
+
+import "bufio"
+
+// Strikes the world with the disasters of the simulation, each happens with its probability every iteration.
+func (w *WorldX) strikeDisasters(writer *bufio.Writer) {
+    if w.options.BridgeCollapseChance > 0 && w.rng.Float64() < w.options.BridgeCollapseChance {
+        w.collapseBridge(writer)
+    }
+    if w.options.QuarantineChance > 0 && w.rng.Float64() < w.options.QuarantineChance {
+        w.quarantineCity(writer)
+    }
+}
+
+// Cuts a random road of the world, both ways if it's bidirectional.
+func (w *WorldX) collapseBridge(writer *bufio.Writer) {
+    type road struct {
+        city *City
+        dir  Direction
+    }
+
+    var roads []road
+    for _, city := range w.sortedCities() {
+        for dir, connection := range city.connectedCities {
+            // Bidirectional roads are only counted from one of their ends, so every road is as likely to collapse
+            opposite := Direction(dir).GetOpposite()
+            if connection != nil && (connection.Connection(opposite) != city || city.name < connection.name ||
+                city == connection && Direction(dir) < opposite) {
+                roads = append(roads, road{city, Direction(dir)})
+            }
+        }
+    }
+    if len(roads) == 0 {
+        return
+    }
+
+    r := roads[w.rng.Intn(len(roads))]
+    to, length := r.city.Connection(r.dir), r.city.RoadLength(r.dir)
+    w.emit(writer, Event{Type: BridgeCollapsed, From: r.city.name, To: to.name, Length: length})
+    w.removeRoad(r.city, r.dir)
+}
+
+// Cuts every road and portal leaving and reaching a random city that has any.
+func (w *WorldX) quarantineCity(writer *bufio.Writer) {
+    var cities []*City
+    for _, city := range w.sortedCities() {
+        if !city.IsIsolated() || len(city.incoming) > 0 {
+            cities = append(cities, city)
+        }
+    }
+    if len(cities) == 0 {
+        return
+    }
+
+    city := cities[w.rng.Intn(len(cities))]
+    w.emit(writer, Event{Type: CityQuarantined, City: city.name})
+    for dir := range city.connectedCities {
+        w.removeRoad(city, Direction(dir))
+    }
+    for len(city.portals) > 0 {
+        w.removePortal(city, city.portals[0])
+    }
+    for len(city.incoming) > 0 {
+        for neighbour := range city.incoming {
+            for dir, connection := range neighbour.connectedCities {
+                if connection == city {
+                    w.removeRoad(neighbour, Direction(dir))
+                }
+            }
+        }
+    }
+}
+
+// Removes the road leaving the city in the direction, and the road back if it's bidirectional. Aliens travelling
+// the road are stranded on it, and aliens left in a city without roads are trapped.
+func (w *WorldX) removeRoad(city *City, dir Direction) {
+    to := city.Connection(dir)
+    if to == nil {
+        return
+    }
+
+    bidirectional := to.Connection(dir.GetOpposite()) == city
+    city.setConnection(dir, nil, 0)
+    if bidirectional {
+        to.setConnection(dir.GetOpposite(), nil, 0)
+    }
+
+    for _, a := range w.allUnits() {
+        if t := a.transit; t != nil && (t.from == city && t.to == to || bidirectional && t.from == to && t.to == city) {
+            a.isTrapped = true
+        }
+    }
+    for _, c := range []*City{city, to} {
+        if c.alien != nil && c.IsIsolated() {
+            c.alien.isTrapped = true
+        }
+    }
+}
@@ -0,0 +1,120 @@
+package worldx
+
+import "fmt"
+
+// Removes the road leaving the city in the direction, and the road back if it's bidirectional. Aliens travelling the
+// road are stranded on it, and aliens left in a city without roads are trapped. Returns an error if the city isn't
+// in the world or there's no road in the direction.
+func (w *WorldX) RemoveConnection(city *City, dir Direction) error {
+    if city == nil || w.Cities[city.name] != city {
+        return fmt.Errorf("RemoveConnection: city isn't in the world")
+    } else if !dir.IsValid() {
+        return fmt.Errorf("RemoveConnection: invalid direction %v", dir)
+    } else if city.Connection(dir) == nil {
+        return fmt.Errorf("RemoveConnection: there's no road from %s to the %v", formatName(city.name), dir)
+    }
+
+    w.removeRoad(city, dir)
+    return nil
+}
+
+// Deletes the city with its roads and portals, the alien in it, and its comments. Unlike a destroyed city it isn't
+// counted as destroyed nor rebuilt. Aliens travelling to the city turn back, and aliens left in a city without roads
+// are trapped. Returns an error if there's no city with the name.
+func (w *WorldX) DeleteCity(name string) error {
+    city, ok := w.Cities[name]
+    if !ok {
+        return fmt.Errorf("DeleteCity: there's no city named %s", formatName(name))
+    }
+
+    neighbours := city.Portals()
+    for neighbour := range city.incoming {
+        neighbours = append(neighbours, neighbour)
+    }
+    w.deleteAlien(city.alien)
+    w.deleteCity(city)
+    w.annotations.deleteCity(name)
+    for _, neighbour := range neighbours {
+        if neighbour.alien != nil && neighbour.IsIsolated() {
+            neighbour.alien.isTrapped = true
+        }
+    }
+    return nil
+}
+
+// Renames the city, the roads and portals to it, the roads of the ruins to it, and its comments, keep leading to it.
+// Returns an error if there's no city with the old name, or the new name is empty or taken by another city or ruin.
+func (w *WorldX) RenameCity(oldName string, newName string) error {
+    city, ok := w.Cities[oldName]
+    if !ok {
+        return fmt.Errorf("RenameCity: there's no city named %s", formatName(oldName))
+    } else if newName == oldName {
+        return nil
+    } else if newName == "" {
+        return fmt.Errorf("RenameCity: the new name of %s is empty", formatName(oldName))
+    } else if _, ok := w.Cities[newName]; ok {
+        return fmt.Errorf("RenameCity: there's already a city named %s", formatName(newName))
+    }
+    for _, r := range w.ruins {
+        if r.name == newName {
+            return fmt.Errorf("RenameCity: destroyed city %s is waiting to be rebuilt", formatName(newName))
+        }
+    }
+
+    // Portals of the other cities are kept sorted by name
+    portals := city.Portals()
+    for _, portal := range portals {
+        portal.removePortal(city)
+    }
+    delete(w.Cities, oldName)
+    city.name = newName
+    w.Cities[newName] = city
+    for _, portal := range portals {
+        portal.addPortal(city)
+    }
+
+    for _, r := range w.ruins {
+        for i := range r.roads {
+            if r.roads[i].neighbour == oldName {
+                r.roads[i].neighbour = newName
+            }
+        }
+    }
+    if w.savedCities[oldName] {
+        delete(w.savedCities, oldName)
+        w.savedCities[newName] = true
+    }
+    w.annotations.renameCity(oldName, newName)
+    return nil
+}
+
+// Moves the alien or defender into the city, it stops travelling and is trapped if the city is isolated. Returns an
+// error if the alien or the city aren't in the world, or another alien is in the city.
+func (w *WorldX) MoveAlien(alien *Alien, city *City) error {
+    if alien == nil || w.units(alien.faction)[alien.name] != alien {
+        return fmt.Errorf("MoveAlien: alien isn't in the world")
+    } else if city == nil || w.Cities[city.name] != city {
+        return fmt.Errorf("MoveAlien: city isn't in the world")
+    } else if city.alien != nil && city.alien != alien {
+        return fmt.Errorf("MoveAlien: %v %s is already in %s", city.alien.faction, city.alien.name,
+            formatName(city.name))
+    }
+
+    if alien.location != nil {
+        alien.location.alien = nil
+    }
+    alien.location, alien.transit, alien.isTrapped = city, nil, city.IsIsolated()
+    city.alien = alien
+    return nil
+}
+
+// Removes the alien or defender with the name from the world. Returns an error if there's none.
+func (w *WorldX) RemoveAlien(name string) error {
+    for _, units := range []map[string]*Alien{w.Aliens, w.Defenders} {
+        if a, ok := units[name]; ok {
+            w.deleteAlien(a)
+            return nil
+        }
+    }
+    return fmt.Errorf("RemoveAlien: there's no alien named %s", name)
+}
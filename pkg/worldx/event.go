@@ -0,0 +1,71 @@
+package worldx
+
+import "fmt"
+
+type EventType int
+
+const (
+    CityDestroyed  EventType = iota // Two aliens fought in a city and destroyed it
+    CityDamaged                     // Two aliens fought in a city and damaged it without destroying it
+    AlienDeparted                   // An alien left a city through a road longer than one iteration
+    AliensCollided                  // Two aliens travelling the same road in opposite directions destroyed each other
+    CityRebuilt                     // A destroyed city was rebuilt with its roads to the neighbours that still exist
+    BridgeCollapsed                 // A random road was cut, both ways if it was bidirectional
+    CityQuarantined                 // A random city lost all the roads leaving and reaching it
+    CityDefended                    // An alien met a defender in a city, who died depends on the outcome
+    AlienSpawned                    // An alien spawned a child in an empty city next to its own
+)
+
+// Something that happened during the simulation of the invasion.
+type Event struct {
+    Type      EventType
+    Iteration int
+    City      string         // City where the event happened, empty for events on a road
+    Aliens    []string       // Names of the aliens involved in the event, the alien first when there's a defender
+    From      string         // City where the road of the event starts, empty for events in a city
+    To        string         // City where the road of the event ends, empty for events in a city
+    Length    int            // Length of the road of the event, 0 for events in a city
+    Damage    int            // Damage done to the city, for destroyed cities the damage of all the fights in it
+    Defense   int            // Defense the damaged city has left
+    Outcome   DefenseOutcome // Who died when an alien met a defender
+    Faction   Faction        // Faction of the parent and child of a spawn
+}
+
+// Returns the message describing the event printed during the simulation.
+func (e Event) String() string {
+    switch e.Type {
+    case CityDestroyed:
+        if e.Damage > 1 {
+            return fmt.Sprintf("%s has been destroyed by alien %s and alien %s after taking %d damage",
+                e.City, e.Aliens[0], e.Aliens[1], e.Damage)
+        }
+        return fmt.Sprintf("%s has been destroyed by alien %s and alien %s", e.City, e.Aliens[0], e.Aliens[1])
+    case CityDamaged:
+        return fmt.Sprintf("%s has been damaged by alien %s and alien %s, %d defense left",
+            e.City, e.Aliens[0], e.Aliens[1], e.Defense)
+    case AlienDeparted:
+        return fmt.Sprintf("alien %s left %s for %s, arriving in %d iterations", e.Aliens[0], e.From, e.To, e.Length)
+    case AliensCollided:
+        return fmt.Sprintf("alien %s and alien %s destroyed each other on the road between %s and %s",
+            e.Aliens[0], e.Aliens[1], e.From, e.To)
+    case CityRebuilt:
+        return fmt.Sprintf("%s has been rebuilt", e.City)
+    case BridgeCollapsed:
+        return fmt.Sprintf("the road from %s to %s has collapsed", e.From, e.To)
+    case CityQuarantined:
+        return fmt.Sprintf("%s has been quarantined", e.City)
+    case CityDefended:
+        switch e.Outcome {
+        case BothKilled:
+            return fmt.Sprintf("alien %s and defender %s killed each other in %s", e.Aliens[0], e.Aliens[1], e.City)
+        case DefenderKilled:
+            return fmt.Sprintf("defender %s has been killed by alien %s in %s", e.Aliens[1], e.Aliens[0], e.City)
+        default:
+            return fmt.Sprintf("alien %s has been killed by defender %s in %s", e.Aliens[0], e.Aliens[1], e.City)
+        }
+    case AlienSpawned:
+        return fmt.Sprintf("%[1]v %[2]s spawned %[1]v %[3]s in %[4]s", e.Faction, e.Aliens[0], e.Aliens[1], e.City)
+    default:
+        return fmt.Sprintf("unknown event %d", e.Type)
+    }
+}
@@ -0,0 +1,243 @@
+// Package generate builds world maps procedurally, grids, grids with holes, mazes and lattices of any size, e.g. for
+// scale tests and demos.
+package generate
+
+import (
+    "fmt"
+    "math/rand"
+    "strconv"
+    "strings"
+
+    "github.com/tomasnunes/invasion/pkg/worldx"
+)
+
+// Shape of the roads between the cities of a generated map, all of them lay the cities on a grid.
+type Topology int
+
+const (
+    Grid          Topology = iota // Every city connected to its neighbours north, south, east and west
+    GridWithHoles                 // A grid with random cities left out
+    Maze                          // A random spanning tree of the grid, a single path between any two cities
+    Lattice                       // A random connected subset of the grid and one diagonal of each cell
+)
+
+const (
+    defaultWidth      int     = 10  // Columns of the grid
+    defaultHoleChance float64 = 0.2 // Chance of a city being left out of a grid with holes
+    defaultDensity    float64 = 0.5 // Fraction of the possible roads of a lattice it has
+)
+
+var topologyNames = []string{
+    Grid:          "grid",
+    GridWithHoles: "holes",
+    Maze:          "maze",
+    Lattice:       "lattice",
+}
+
+func (t Topology) String() string {
+    if t < 0 || int(t) >= len(topologyNames) {
+        return "Topology(" + strconv.Itoa(int(t)) + ")"
+    }
+    return topologyNames[t]
+}
+
+// Returns the topology with the name, grid, holes, maze or lattice, and false if there's none.
+func GetTopology(name string) (Topology, bool) {
+    for t, topologyName := range topologyNames {
+        if topologyName == name {
+            return Topology(t), true
+        }
+    }
+    return Grid, false
+}
+
+// Options of a generated map, the zero value is a 10x10 grid with cities named by their row and column.
+type Options struct {
+    Topology      Topology
+    Width         int     // Columns of the grid, 0 for defaultWidth
+    Height        int     // Rows of the grid, 0 for Width
+    Seed          int64   // Seed of the random choices, maps with the same options and seed are the same
+    HoleChance    float64 // Chance of each city being left out of a grid with holes, 0 for defaultHoleChance
+    Density       float64 // Fraction of the possible roads of a lattice it has, 0 for defaultDensity
+    Pronounceable bool    // Names the cities with random pronounceable names instead of their row and column
+}
+
+// Returns a world with the map generated with the options, or an error if the options aren't valid.
+func Generate(options Options) (*worldx.WorldX, error) {
+    width, height := options.Width, options.Height
+    if width == 0 {
+        width = defaultWidth
+    }
+    if height == 0 {
+        height = width
+    }
+    holeChance, density := options.HoleChance, options.Density
+    if holeChance == 0 {
+        holeChance = defaultHoleChance
+    }
+    if density == 0 {
+        density = defaultDensity
+    }
+    if width < 0 || height < 0 {
+        return nil, fmt.Errorf("Generate: invalid size %dx%d", width, height)
+    } else if holeChance < 0 || holeChance >= 1 {
+        return nil, fmt.Errorf("Generate: invalid hole chance %v, should be in [0, 1)", holeChance)
+    } else if density < 0 || density > 1 {
+        return nil, fmt.Errorf("Generate: invalid density %v, should be in [0, 1]", density)
+    } else if options.Topology < Grid || options.Topology > Lattice {
+        return nil, fmt.Errorf("Generate: unknown topology %v", options.Topology)
+    }
+
+    g := generator{width: width, height: height, rng: rand.New(rand.NewSource(options.Seed)),
+        world: &worldx.WorldX{}}
+    g.createCities(options.Topology == GridWithHoles, holeChance, options.Pronounceable)
+
+    switch options.Topology {
+    case Grid, GridWithHoles:
+        for _, road := range g.candidateRoads(false) {
+            g.connect(road)
+        }
+    case Maze:
+        for _, road := range g.spanningTree(g.candidateRoads(false)) {
+            g.connect(road)
+        }
+    case Lattice:
+        g.world.SetDirections(worldx.North, worldx.South, worldx.East, worldx.West, worldx.NorthEast,
+            worldx.NorthWest, worldx.SouthEast, worldx.SouthWest)
+        g.lattice(density)
+    }
+    return g.world, nil
+}
+
+// State of a map being generated, the cities of the grid are indexed by row and then column.
+type generator struct {
+    width, height int
+    rng           *rand.Rand
+    world         *worldx.WorldX
+    cities        []*worldx.City // Cities of the grid, nil for holes
+}
+
+// Road between two cities of the grid, leaving the first in the direction.
+type road struct {
+    from, to int
+    dir      worldx.Direction
+}
+
+func (g *generator) createCities(holes bool, holeChance float64, pronounceable bool) {
+    g.cities = make([]*worldx.City, g.width*g.height)
+    taken := make(map[string]bool)
+    for i := range g.cities {
+        if holes && g.rng.Float64() < holeChance {
+            continue
+        }
+
+        name := strconv.Itoa(i/g.width) + "-" + strconv.Itoa(i%g.width)
+        if pronounceable {
+            name = pronounceableName(g.rng, taken)
+        }
+        g.cities[i] = g.world.CreateCity(name)
+    }
+}
+
+// Returns the roads between neighbouring cities of the grid, east and south of each city, and one random diagonal
+// of each cell if diagonals is true, so no roads cross.
+func (g *generator) candidateRoads(diagonals bool) (roads []road) {
+    for i, city := range g.cities {
+        row, column := i/g.width, i%g.width
+        if city == nil {
+            continue
+        }
+        if column+1 < g.width && g.cities[i+1] != nil {
+            roads = append(roads, road{i, i + 1, worldx.East})
+        }
+        if row+1 < g.height && g.cities[i+g.width] != nil {
+            roads = append(roads, road{i, i + g.width, worldx.South})
+        }
+        if diagonals && column+1 < g.width && row+1 < g.height {
+            if g.rng.Intn(2) == 0 {
+                roads = append(roads, road{i, i + g.width + 1, worldx.SouthEast})
+            } else {
+                roads = append(roads, road{i + 1, i + g.width, worldx.SouthWest})
+            }
+        }
+    }
+    return
+}
+
+// Returns a random spanning tree of the roads, the roads in a random order that don't close a cycle.
+func (g *generator) spanningTree(roads []road) (tree []road) {
+    g.rng.Shuffle(len(roads), func(i, j int) { roads[i], roads[j] = roads[j], roads[i] })
+
+    parents := make([]int, len(g.cities))
+    for i := range parents {
+        parents[i] = i
+    }
+    var find func(i int) int
+    find = func(i int) int {
+        for parents[i] != i {
+            parents[i], i = parents[parents[i]], parents[i]
+        }
+        return i
+    }
+
+    for _, road := range roads {
+        if from, to := find(road.from), find(road.to); from != to {
+            parents[from] = to
+            tree = append(tree, road)
+        }
+    }
+    return
+}
+
+// Connects the cities with a random spanning tree of the lattice, and random roads of it until the fraction of the
+// possible roads reaches the density.
+func (g *generator) lattice(density float64) {
+    roads := g.candidateRoads(true)
+    target := int(density*float64(len(roads)) + 0.5)
+    tree := g.spanningTree(roads)
+    inTree := make(map[road]bool, len(tree))
+    for _, road := range tree {
+        inTree[road] = true
+        g.connect(road)
+    }
+
+    // The roads were shuffled by spanningTree
+    for _, road := range roads {
+        if len(inTree) >= target {
+            break
+        } else if !inTree[road] {
+            inTree[road] = true
+            g.connect(road)
+        }
+    }
+}
+
+func (g *generator) connect(road road) {
+    g.world.AddConnection(g.cities[road.from], g.cities[road.to], road.dir)
+}
+
+var (
+    onsets = []string{"b", "br", "d", "dr", "f", "g", "gr", "k", "l", "m", "n", "p", "r", "s", "st", "t", "tr", "v",
+        "z"}
+    vowels = []string{"a", "e", "i", "o", "u", "ai", "ou"}
+    codas  = []string{"", "", "", "n", "r", "s", "l"}
+)
+
+// Returns a random capitalized name made of syllables that isn't taken yet, and takes it. Names get longer when
+// they collide so there are always enough of them.
+func pronounceableName(rng *rand.Rand, taken map[string]bool) string {
+    for attempt := 0; ; attempt++ {
+        var b strings.Builder
+        syllables := 2 + rng.Intn(2) + attempt/4
+        for i := 0; i < syllables; i++ {
+            b.WriteString(onsets[rng.Intn(len(onsets))])
+            b.WriteString(vowels[rng.Intn(len(vowels))])
+        }
+        b.WriteString(codas[rng.Intn(len(codas))])
+
+        if name := b.String(); !taken[name] {
+            taken[name] = true
+            return strings.ToUpper(name[:1]) + name[1:]
+        }
+    }
+}
@@ -0,0 +1,57 @@
+package generate_test
+
+import (
+    "strings"
+    "testing"
+
+    "github.com/tomasnunes/invasion/pkg/worldx"
+    "github.com/tomasnunes/invasion/pkg/worldx/analysis"
+    "github.com/tomasnunes/invasion/pkg/worldx/generate"
+)
+
+func TestGenerate(t *testing.T) {
+    testCases := []struct {
+        options    generate.Options
+        cities     int // Cities of the map, -1 if random
+        roads      int // Roads between two cities of the map, -1 if random
+        components int // Components of the map, -1 if random
+    }{
+        {generate.Options{}, 100, 180, 1},
+        {generate.Options{Topology: generate.GridWithHoles, Width: 20, Seed: 1}, -1, -1, -1},
+        {generate.Options{Topology: generate.Maze, Width: 30, Height: 20, Seed: 2, Pronounceable: true}, 600, 599, 1},
+        // 80% of the 180 roads of the grid and its 81 diagonals
+        {generate.Options{Topology: generate.Lattice, Width: 10, Seed: 3, Density: 0.8}, 100, 209, 1},
+    }
+
+    for _, tc := range testCases {
+        world, err := generate.Generate(tc.options)
+        if err != nil {
+            t.Fatalf("%v: %v", tc.options.Topology, err)
+        }
+        if errs := world.Validate(); len(errs) > 0 {
+            t.Errorf("%v: generated world should be valid: %v", tc.options.Topology, errs)
+        }
+
+        roads := 0
+        for _, city := range world.Cities {
+            roads += len(city.Roads())
+        }
+        components := len(analysis.New(world).Components())
+        if tc.cities >= 0 && len(world.Cities) != tc.cities || tc.roads >= 0 && roads != 2*tc.roads ||
+            tc.components >= 0 && components != tc.components {
+            t.Errorf("%v: expected %d cities, %d roads and %d components, got %d, %d and %d", tc.options.Topology,
+                tc.cities, tc.roads, tc.components, len(world.Cities), roads/2, components)
+        }
+
+        again, _ := generate.Generate(tc.options)
+        read := worldx.WorldX{}
+        read.ReadWorldMap(strings.NewReader(world.String()))
+        if again.String() != world.String() || read.String() != world.String() {
+            t.Errorf("%v: maps with the same seed should be the same and be read back", tc.options.Topology)
+        }
+    }
+
+    if _, err := generate.Generate(generate.Options{Topology: generate.Lattice, Density: 2}); err == nil {
+        t.Error("Lattices with a density over 1 shouldn't be generated")
+    }
+}
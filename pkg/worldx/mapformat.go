@@ -0,0 +1,559 @@
+package worldx
+
+import (
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "errors"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+
+    "github.com/klauspost/compress/zstd"
+)
+
+// Highest version of the world map format understood by ReadWorldMap.
+const MapFormatVersion int = 1
+
+const (
+    commentPrefix       string = "#"
+    directivePrefix     string = "%"
+    directionSeparator  string = "="
+    oneWayPrefix        string = ">"
+    roadLengthSeparator string = ":"
+    defenseAttribute    string = "defense"
+    costAttribute       string = "cost"
+    portalKey           string = "portal"
+    regionAttribute     string = "region"
+    headerDirective     string = "worldx"
+    directionsDirective string = "directions"
+    directionDirective  string = "direction"
+    regionDirective     string = "region"
+)
+
+// Options to read a world map with ReadWorldMapWithOptions, the zero value reads any valid map.
+type ReadOptions struct {
+    MaxLineLength int                  // Maximum length in bytes of a line of the map, 0 accepts lines of any length
+    Aliases       map[string]Direction // Direction aliases only for this map, take precedence over the world ones
+    DropComments  bool                 // Comments of the map aren't kept to be written back, see WorldX.String
+}
+
+// Non-fatal issue found while reading a world map, e.g. a direction written with an alias.
+type Diagnostic struct {
+    Line      int
+    Message   string
+    Unfixable bool // Part of the map was ignored as it couldn't be read as written, e.g. two roads north of a city
+}
+
+func (d Diagnostic) String() string {
+    return fmt.Sprintf("line %d: %s", d.Line, d.Message)
+}
+
+// Returned when a line of the world map is longer than ReadOptions.MaxLineLength.
+var ErrLineTooLong = errors.New("line too long")
+
+var (
+    gzipMagic = []byte{0x1f, 0x8b}
+    zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Wraps reader with a buffered reader that transparently decompresses gzip and zstd streams.
+// The returned function releases the resources of the decompressor and should always be called.
+func decompressMap(reader io.Reader) (*bufio.Reader, func(), error) {
+    buffered := bufio.NewReader(reader)
+    magic, _ := buffered.Peek(len(zstdMagic))
+
+    switch {
+    case bytes.HasPrefix(magic, gzipMagic):
+        gzipReader, err := gzip.NewReader(buffered)
+        if err != nil {
+            return nil, nil, err
+        }
+        return bufio.NewReader(gzipReader), func() { _ = gzipReader.Close() }, nil
+    case bytes.HasPrefix(magic, zstdMagic):
+        zstdReader, err := zstd.NewReader(buffered)
+        if err != nil {
+            return nil, nil, err
+        }
+        return bufio.NewReader(zstdReader), zstdReader.Close, nil
+    default:
+        return buffered, func() {}, nil
+    }
+}
+
+// Reads the next line of the map without the line terminator, lines can be longer than the buffer of the reader.
+// Returns io.EOF when there are no more lines, or ErrLineTooLong if maxLength > 0 and the line exceeds it.
+func readMapLine(reader *bufio.Reader, maxLength int) (string, error) {
+    var line []byte
+    for {
+        fragment, err := reader.ReadSlice('\n')
+        line = append(line, fragment...)
+        if maxLength > 0 && len(bytes.TrimRight(line, "\r\n")) > maxLength {
+            return "", ErrLineTooLong
+        }
+
+        if err == bufio.ErrBufferFull {
+            continue
+        } else if err == io.EOF && len(line) > 0 {
+            break
+        } else if err != nil {
+            return "", err
+        }
+        break
+    }
+
+    return string(bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))), nil
+}
+
+// Field of a line of the world map, either a plain value (e.g. the city name) or a `key=value` pair.
+type mapField struct {
+    key    string
+    value  string
+    hasKey bool
+    quoted bool   // The value was written between double quotes
+    suffix string // Text right after the closing quote of a quoted value, e.g. the length of a road
+}
+
+// Splits a line of the world map into its whitespace separated fields, unquoting quoted values, and its comment,
+// everything after a `#` that starts a field. The first field never has a key, since city names may contain `=`.
+func splitMapLine(line string) (fields []mapField, comment string, err error) {
+    for i := 0; ; {
+        i = skipSpaces(line, i)
+        if i >= len(line) {
+            return
+        } else if strings.HasPrefix(line[i:], commentPrefix) {
+            return fields, strings.TrimRightFunc(line[i:], unicode.IsSpace), nil
+        }
+
+        var field mapField
+        if len(fields) > 0 && line[i] != '"' {
+            end := fieldEnd(line, i)
+            if sep := strings.Index(line[i:end], directionSeparator); sep >= 0 {
+                field.key, field.hasKey = line[i:i+sep], true
+                i += sep + len(directionSeparator)
+            }
+        }
+
+        if i < len(line) && line[i] == '"' {
+            field.quoted = true
+            if field.value, i, err = readQuoted(line, i); err != nil {
+                return nil, "", err
+            }
+            if end := fieldEnd(line, i); strings.HasPrefix(line[i:end], roadLengthSeparator) {
+                field.suffix, i = line[i:end], end
+            } else if end > i {
+                return nil, "", fmt.Errorf("unexpected %q after quoted name", line[i:end])
+            }
+        } else {
+            end := fieldEnd(line, i)
+            field.value, i = line[i:end], end
+        }
+
+        fields = append(fields, field)
+    }
+}
+
+// Reads the double quoted string starting at line[start], returns its unquoted value and the index after the
+// closing quote. Escape sequences follow the Go string literal rules.
+func readQuoted(line string, start int) (string, int, error) {
+    for i := start + 1; i < len(line); i++ {
+        switch line[i] {
+        case '\\':
+            i++
+        case '"':
+            value, err := strconv.Unquote(line[start : i+1])
+            if err != nil {
+                return "", 0, fmt.Errorf("invalid quoted name %s", line[start:i+1])
+            }
+            return value, i + 1, nil
+        }
+    }
+    return "", 0, errors.New("unterminated quoted name")
+}
+
+func skipSpaces(line string, i int) int {
+    for i < len(line) {
+        r, size := utf8.DecodeRuneInString(line[i:])
+        if !unicode.IsSpace(r) {
+            break
+        }
+        i += size
+    }
+    return i
+}
+
+func fieldEnd(line string, i int) int {
+    if end := strings.IndexFunc(line[i:], unicode.IsSpace); end >= 0 {
+        return i + end
+    }
+    return len(line)
+}
+
+// Splits the value of a connection field into the name of the connected city and the length of the road,
+// e.g. `Bar:3`, roads without an explicit length have length 1. Quoted names never contain the length.
+func (f mapField) roadLength() (name string, length int, err error) {
+    name, suffix := f.value, f.suffix
+    if !f.quoted && hasRoadLength(name) {
+        i := strings.LastIndex(name, roadLengthSeparator)
+        name, suffix = name[:i], name[i:]
+    }
+
+    if suffix == "" {
+        return name, 1, nil
+    } else if length, err = strconv.Atoi(strings.TrimPrefix(suffix, roadLengthSeparator)); err != nil || length < 1 {
+        return "", 0, fmt.Errorf("invalid road length %q", suffix)
+    }
+    return name, length, nil
+}
+
+// Returns true if the name ends with what would be read as the length of a road, e.g. `Bar:3`.
+func hasRoadLength(name string) bool {
+    i := strings.LastIndex(name, roadLengthSeparator)
+    if i <= 0 || i == len(name)-1 {
+        return false
+    }
+    for _, r := range name[i+1:] {
+        if r < '0' || r > '9' {
+            return false
+        }
+    }
+    return true
+}
+
+// Returns true if the field is a directive (e.g. `%worldx 1`) instead of the name of a city.
+func (f mapField) isDirective() bool {
+    return !f.quoted && !f.hasKey && strings.HasPrefix(f.value, directivePrefix)
+}
+
+// Returns the name as it should be written in a world map, quoted only if it couldn't be read back otherwise.
+func formatName(name string) string {
+    if needsQuoting(name) {
+        return strconv.Quote(name)
+    }
+    return name
+}
+
+// Returns the connection to the city as it should be written in a world map, with the length of the road unless it's 1.
+func formatRoad(name string, length int) string {
+    if length != 1 {
+        return formatName(name) + roadLengthSeparator + strconv.Itoa(length)
+    }
+    return formatName(name)
+}
+
+func needsQuoting(name string) bool {
+    if name == "" || strings.HasPrefix(name, `"`) || hasRoadLength(name) ||
+        strings.HasPrefix(name, commentPrefix) || strings.HasPrefix(name, directivePrefix) {
+        return true
+    }
+
+    for _, r := range name {
+        if unicode.IsSpace(r) || !unicode.IsPrint(r) {
+            return true
+        }
+    }
+    return false
+}
+
+// State of a world map being read by ReadWorldMapWithOptions.
+type mapReader struct {
+    world       *WorldX
+    options     ReadOptions
+    lineNumber  int
+    readContent bool // A line other than blank lines and comments was already read
+    readCities  bool     // A city was already read
+    comments    []string // Comment lines not attached yet to the line of the map after them
+    diagnostics []Diagnostic
+}
+
+func (r *mapReader) warnf(format string, args ...interface{}) {
+    r.diagnostics = append(r.diagnostics, Diagnostic{Line: r.lineNumber, Message: fmt.Sprintf(format, args...)})
+}
+
+// Reports a part of the map that was ignored, since it couldn't be read as written.
+func (r *mapReader) conflictf(format string, args ...interface{}) {
+    r.diagnostics = append(r.diagnostics, Diagnostic{Line: r.lineNumber, Message: fmt.Sprintf(format, args...),
+        Unfixable: true})
+}
+
+// Returns the direction with the name or alias, ignoring case, and warns if it isn't written in its canonical form.
+func (r *mapReader) getDirection(name string) Direction {
+    var dir Direction = UnknownDirection
+    for alias, aliasDir := range r.options.Aliases {
+        if strings.EqualFold(alias, name) {
+            dir = aliasDir
+            break
+        }
+    }
+    if !dir.IsValid() {
+        dir = r.world.GetDirection(name)
+    }
+
+    if dir.IsValid() && name != dir.String() {
+        r.warnf("direction %q read as %q", name, dir.String())
+    }
+    return dir
+}
+
+// Reads a line of the world map, either a directive or a city with its connections, keeping its comments.
+func (r *mapReader) readLine(line string) error {
+    fields, comment, err := splitMapLine(line)
+    if err != nil {
+        return err
+    } else if r.options.DropComments && comment != "" {
+        if len(fields) == 0 {
+            return nil
+        }
+        comment = ""
+    }
+    if len(fields) == 0 {
+        r.readComment(comment)
+        return nil
+    }
+
+    if fields[0].isDirective() {
+        if err = r.readDirective(fields); err == nil {
+            r.annotateDirective(line, fields, comment)
+        }
+    } else {
+        err = r.readCity(fields)
+        r.annotateCity(fields[0].value, comment)
+        r.readCities = true
+    }
+    r.readContent = true
+    return err
+}
+
+// Applies a directive line of the world map.
+func (r *mapReader) readDirective(fields []mapField) error {
+    name, args := strings.TrimPrefix(fields[0].value, directivePrefix), fields[1:]
+    if name != headerDirective && name != regionDirective && r.readCities {
+        return fmt.Errorf("%s%s must be declared before the cities", directivePrefix, name)
+    }
+
+    switch name {
+    case headerDirective:
+        if r.readContent {
+            return fmt.Errorf("%s%s header must be the first line of the map", directivePrefix, headerDirective)
+        } else if len(args) != 1 {
+            return fmt.Errorf("%s%s header expects a single version", directivePrefix, headerDirective)
+        }
+
+        version, err := strconv.Atoi(args[0].value)
+        if err != nil || version < 1 {
+            return fmt.Errorf("invalid map format version %q", args[0].value)
+        } else if version > MapFormatVersion {
+            return fmt.Errorf("unsupported map format version %d, highest supported is %d", version, MapFormatVersion)
+        }
+        return nil
+    case directionsDirective:
+        // `%directions <set or direction>...` replaces the directions of the world
+        var dirs []Direction
+        for _, arg := range args {
+            if preset := getDirectionPreset(arg.value); preset != nil {
+                dirs = append(dirs, preset...)
+            } else if dir := r.getDirection(arg.value); dir.IsValid() {
+                dirs = append(dirs, dir)
+            } else {
+                return fmt.Errorf("unknown direction or set of directions %q", arg.value)
+            }
+        }
+        if len(dirs) == 0 {
+            return fmt.Errorf("%s%s expects at least one direction", directivePrefix, directionsDirective)
+        }
+        r.world.SetDirections(dirs...)
+        return nil
+    case directionDirective:
+        // `%direction <name> <opposite> [alias]...` declares a custom direction and adds it to the world
+        if len(args) < 2 {
+            return fmt.Errorf("%s%s expects a direction and its opposite", directivePrefix, directionDirective)
+        }
+
+        aliases := make([]string, 0, len(args)-2)
+        for _, arg := range args[2:] {
+            aliases = append(aliases, arg.value)
+        }
+        _, err := r.world.DeclareDirection(args[0].value, args[1].value, aliases...)
+        return err
+    case regionDirective:
+        // `%region <name> <city>...` sets the region attribute of the cities, creating them if needed
+        if len(args) < 1 || len(args[0].value) == 0 {
+            return fmt.Errorf("%s%s expects a region name", directivePrefix, regionDirective)
+        }
+
+        for _, arg := range args[1:] {
+            if arg.hasKey || arg.suffix != "" {
+                return fmt.Errorf("%s%s expects city names, got %q", directivePrefix, regionDirective, arg.value)
+            }
+            field := mapField{key: regionAttribute, value: args[0].value, hasKey: true}
+            if err := r.readAttribute(r.world.CreateCity(arg.value), field); err != nil {
+                return err
+            }
+        }
+        return nil
+    default:
+        return fmt.Errorf("unknown directive %s%s", directivePrefix, name)
+    }
+}
+
+// Creates the city described by the fields of a line of the world map with its connections and attributes.
+// Fields that aren't connections are read as `key=value` attributes of the city.
+func (r *mapReader) readCity(fields []mapField) error {
+    newCity := r.world.CreateCity(fields[0].value)
+
+    for _, field := range fields[1:] {
+        if !field.hasKey {
+            r.conflictf("ignored %q, expected a connection or attribute of %s", field.value, formatName(newCity.name))
+            continue
+        }
+
+        if field.key == portalKey {
+            if err := r.readPortal(newCity, field); err != nil {
+                return err
+            }
+            continue
+        }
+
+        oneWay := strings.HasPrefix(field.key, oneWayPrefix)
+        dir := r.getDirection(strings.TrimPrefix(field.key, oneWayPrefix))
+        if !dir.IsValid() {
+            if err := r.readAttribute(newCity, field); err != nil {
+                return err
+            }
+            continue
+        }
+
+        // Ignore directions without city name, with empty city name, and directions the world doesn't have
+        if !r.world.HasDirection(dir) {
+            r.conflictf("ignored connection %s=%s, the map doesn't declare direction %v",
+                field.key, formatName(field.value), dir)
+        } else if len(field.value) > 0 {
+            name, length, err := field.roadLength()
+            if err != nil {
+                return err
+            }
+
+            // Only add connection if it doesn't exist yet, duplicated connections are ignored
+            explicitLength := field.suffix != "" || !field.quoted && hasRoadLength(field.value)
+            if connection := newCity.Connection(dir); connection != nil && connection.name != name {
+                r.conflictf("ignored %s=%s, road %v of %s already leads to %s", field.key, formatRoad(name, length),
+                    dir, formatName(newCity.name), formatName(connection.name))
+            } else if connection != nil && explicitLength && newCity.RoadLength(dir) != length {
+                r.conflictf("ignored %s=%s, road %v of %s is already %d long", field.key, formatRoad(name, length),
+                    dir, formatName(newCity.name), newCity.RoadLength(dir))
+            } else if connection == nil {
+                connectedCity := r.world.CreateCity(name)
+                // The road back is left as written if it already leads to another city
+                opposite := dir.GetOpposite()
+                if back := connectedCity.Connection(opposite); !oneWay && back != nil && back != newCity {
+                    r.conflictf("ignored road %v of %s back to %s, it already leads to %s", opposite,
+                        formatName(connectedCity.name), formatName(newCity.name), formatName(back.name))
+                    oneWay = true
+                } else if !oneWay && !r.world.HasDirection(opposite) {
+                    r.conflictf("ignored road %v of %s back to %s, the map doesn't declare direction %v", opposite,
+                        formatName(connectedCity.name), formatName(newCity.name), opposite)
+                    oneWay = true
+                }
+                if oneWay {
+                    r.world.AddOneWayConnection(newCity, connectedCity, dir)
+                } else {
+                    r.world.AddConnection(newCity, connectedCity, dir)
+                }
+                r.world.SetRoadLength(newCity, dir, length)
+            }
+        }
+    }
+
+    return nil
+}
+
+// Adds the portal between the city and the city named by the field, portals without city name are ignored.
+func (r *mapReader) readPortal(city *City, field mapField) error {
+    name, length, err := field.roadLength()
+    if err != nil {
+        return err
+    } else if length != 1 {
+        return fmt.Errorf("portal=%s can't have a length, portals are taken in one iteration", field.value)
+    }
+
+    if len(name) > 0 {
+        r.world.AddPortal(city, r.world.CreateCity(name))
+    }
+    return nil
+}
+
+// Sets the attribute of the city described by the field, an attribute set more than once keeps its first value.
+func (r *mapReader) readAttribute(city *City, field mapField) error {
+    if !isValidAttributeName(field.key) {
+        r.conflictf("ignored %s=%s, %q is neither a direction nor a valid attribute name",
+            field.key, formatName(field.value), field.key)
+        return nil
+    } else if field.suffix != "" {
+        return fmt.Errorf("unexpected %q after quoted value of attribute %s", field.suffix, field.key)
+    }
+
+    if value, ok := city.Attribute(field.key); !ok {
+        city.SetAttribute(field.key, field.value)
+    } else if value != field.value {
+        r.conflictf("ignored %s=%s, attribute of %s already set to %s",
+            field.key, formatName(field.value), formatName(city.name), formatName(value))
+    }
+    return nil
+}
+
+// Attribute names follow the same rules as direction names and can't be the name of a built-in direction, or
+// `portal`. The reader only reads as attributes the names that aren't directions of the map.
+func isValidAttributeName(key string) bool {
+    return isValidDirectionName(key) && !GetDirection(key).IsValid() && key != portalKey
+}
+
+// Returns the directives needed to read back the directions of the world, empty for the default directions.
+func (w *WorldX) mapHeader() (header string) {
+    dirs := w.Directions()
+    if equalDirections(dirs, defaultDirections) {
+        return
+    }
+
+    header = directivePrefix + headerDirective + " " + strconv.Itoa(MapFormatVersion) + "\n"
+    for i, dir := range dirs {
+        // Directions are declared once with their opposite, and again if they have aliases
+        opposite, aliases := dir.GetOpposite(), w.directionAliases(dir)
+        if dir > MaxDirections && !containsDirection(dirs[:i], opposite) || len(aliases) > 0 {
+            header += directivePrefix + directionDirective + " " + dir.String() + " " + opposite.String()
+            for _, alias := range aliases {
+                header += " " + alias
+            }
+            header += "\n"
+        }
+    }
+
+    header += directivePrefix + directionsDirective
+    for _, dir := range dirs {
+        header += " " + dir.String()
+    }
+    return header + "\n"
+}
+
+func equalDirections(dirs1 []Direction, dirs2 []Direction) bool {
+    if len(dirs1) != len(dirs2) {
+        return false
+    }
+    for i := range dirs1 {
+        if dirs1[i] != dirs2[i] {
+            return false
+        }
+    }
+    return true
+}
+
+func containsDirection(dirs []Direction, dir Direction) bool {
+    for _, d := range dirs {
+        if d == dir {
+            return true
+        }
+    }
+    return false
+}
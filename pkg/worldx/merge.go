@@ -0,0 +1,100 @@
+package worldx
+
+import (
+    "fmt"
+    "sort"
+)
+
+// Adds the cities, roads, portals, attributes and comments of the other world to this one, cities with the same name
+// being the same city, and the directions of the other world this one doesn't have. Returns an error for every road of
+// the other world that leaves a city in the same direction as a road of this one to another city or with another
+// length, for every attribute with another value, and for every direction declared with another opposite, without
+// changing the world. Returns nil if the worlds were merged.
+func (w *WorldX) Merge(other *WorldX) (errs []error) {
+    names := make([]string, 0, len(other.directionNames))
+    for name := range other.directionNames {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    for _, name := range names {
+        if dir, otherDir := w.GetDirection(name), other.directionNames[name]; dir.IsValid() && dir != otherDir {
+            errs = append(errs, fmt.Errorf("direction %s is %v with opposite %v, can't merge %v with opposite %v",
+                name, dir, dir.GetOpposite(), otherDir, otherDir.GetOpposite()))
+        }
+    }
+    for _, otherCity := range other.sortedCities() {
+        city, ok := w.Cities[otherCity.name]
+        if !ok {
+            continue
+        }
+
+        name := formatName(city.name)
+        for key, value := range otherCity.attributes {
+            if current, ok := city.attributes[key]; ok && current != value {
+                errs = append(errs, fmt.Errorf("attribute %s of %s is %s, can't merge %s", key, name,
+                    formatName(current), formatName(value)))
+            }
+        }
+        for _, road := range otherCity.Roads() {
+            if road.Portal {
+                continue
+            } else if current := city.Connection(road.Direction); current == nil {
+                continue
+            } else if current.name != road.Destination.name {
+                errs = append(errs, fmt.Errorf("road %v of %s leads to %s, can't merge the road to %s", road.Direction,
+                    name, formatName(current.name), formatName(road.Destination.name)))
+            } else if length := city.RoadLength(road.Direction); length != road.Length {
+                errs = append(errs, fmt.Errorf("road %v of %s is %d long, can't merge a road %d long", road.Direction,
+                    name, length, road.Length))
+            }
+        }
+    }
+    if len(errs) > 0 {
+        return
+    }
+
+    if len(other.directionNames) > 0 && w.directionNames == nil {
+        w.directionNames = make(map[string]Direction, len(other.directionNames))
+    }
+    for name, dir := range other.directionNames {
+        w.directionNames[name] = dir
+    }
+    dirs := w.Directions()
+    for _, dir := range other.Directions() {
+        if !containsDirection(dirs, dir) {
+            dirs = append(dirs, dir)
+        }
+    }
+    if len(dirs) > len(w.Directions()) {
+        w.SetDirections(dirs...)
+    }
+
+    for _, otherCity := range other.sortedCities() {
+        city := w.CreateCity(otherCity.name)
+        for key, value := range otherCity.attributes {
+            if _, ok := city.attributes[key]; !ok {
+                city.SetAttribute(key, value)
+            }
+        }
+    }
+    for _, otherCity := range other.sortedCities() {
+        city := w.Cities[otherCity.name]
+        for _, road := range otherCity.Roads() {
+            destination := w.Cities[road.Destination.name]
+            if destination == nil {
+                continue
+            } else if road.Portal {
+                w.AddPortal(city, destination)
+            } else if city.Connection(road.Direction) == nil {
+                city.setConnection(road.Direction, destination, road.Length)
+            }
+        }
+        if city.alien != nil && city.alien.transit == nil && !city.IsIsolated() {
+            city.alien.isTrapped = false
+        }
+    }
+    if other.annotations != nil {
+        w.mapAnnotations().merge(other.annotations)
+    }
+    return nil
+}
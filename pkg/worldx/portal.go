@@ -0,0 +1,64 @@
+package worldx
+
+import (
+    "log"
+    "sort"
+)
+
+// Add portal between city1 and city2, a connection without direction aliens can take both ways in one iteration.
+// Panics if any of the cities doesn't exist, portals from a city to itself or that already exist are ignored.
+func (w *WorldX) AddPortal(city1 *City, city2 *City) {
+    if city1 == nil || city2 == nil {
+        log.Panicln("AddPortal: city doesn't exist, cannot create portal if either city is <nil>.")
+    } else if city1 == city2 || city1.HasPortal(city2) {
+        return
+    }
+
+    city1.addPortal(city2)
+    city2.addPortal(city1)
+    for _, c := range []*City{city1, city2} {
+        if c.alien != nil && c.alien.isTrapped && c.alien.transit == nil {
+            c.alien.isTrapped = false
+        }
+    }
+}
+
+// Removes the portal between the cities, aliens left in a city without roads or portals are trapped.
+func (w *WorldX) removePortal(city1 *City, city2 *City) {
+    city1.removePortal(city2)
+    city2.removePortal(city1)
+    for _, c := range []*City{city1, city2} {
+        if c.alien != nil && c.IsIsolated() {
+            c.alien.isTrapped = true
+        }
+    }
+}
+
+// Returns the cities connected to the city by portals, sorted by name.
+func (c *City) Portals() []*City {
+    return append([]*City(nil), c.portals...)
+}
+
+// Returns true if there's a portal between the city and the other city.
+func (c *City) HasPortal(city *City) bool {
+    i := c.portalIndex(city)
+    return i < len(c.portals) && c.portals[i] == city
+}
+
+// Returns the index of the city in the portals of c, or where it would be inserted to keep them sorted.
+func (c *City) portalIndex(city *City) int {
+    return sort.Search(len(c.portals), func(i int) bool { return c.portals[i].name >= city.name })
+}
+
+func (c *City) addPortal(city *City) {
+    i := c.portalIndex(city)
+    c.portals = append(c.portals, nil)
+    copy(c.portals[i+1:], c.portals[i:])
+    c.portals[i] = city
+}
+
+func (c *City) removePortal(city *City) {
+    if i := c.portalIndex(city); i < len(c.portals) && c.portals[i] == city {
+        c.portals = append(c.portals[:i], c.portals[i+1:]...)
+    }
+}
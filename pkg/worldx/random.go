@@ -0,0 +1,30 @@
+package worldx
+
+import "math/rand"
+
+// Random source of a world, a splitmix64 generator whose whole state is one number so it can be copied with the world.
+type randomSource struct {
+    state uint64
+}
+
+func (s *randomSource) Seed(seed int64) {
+    s.state = uint64(seed)
+}
+
+func (s *randomSource) Uint64() uint64 {
+    s.state += 0x9e3779b97f4a7c15
+    z := s.state
+    z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+    z = (z ^ z>>27) * 0x94d049bb133111eb
+    return z ^ z>>31
+}
+
+func (s *randomSource) Int63() int64 {
+    return int64(s.Uint64() >> 1)
+}
+
+// Returns a random generator reading from a copy of the source.
+func (s *randomSource) clone() (*randomSource, *rand.Rand) {
+    source := *s
+    return &source, rand.New(&source)
+}
@@ -0,0 +1,145 @@
+package worldx
+
+import (
+    "fmt"
+    "sort"
+)
+
+// Statistics of the cities of a region, cities are grouped in regions by their `region` attribute.
+type RegionStats struct {
+    Name            string
+    InitialCities   int // Cities of the region when the first simulation started
+    Cities          int // Cities of the region left
+    DestroyedCities int // Cities of the region destroyed by the simulations
+    SurvivingAliens int // Aliens in cities of the region
+    FirstFall       int // Iteration of the simulation when the first city of the region was destroyed, -1 if none was
+}
+
+// How the cities of a region fell during the simulations of the world.
+type regionRecord struct {
+    initialCities   int
+    destroyedCities int
+    firstFall       int
+}
+
+// Returns the region of the city, from its `region` attribute, empty if it doesn't belong to any.
+func (c *City) Region() string {
+    region, _ := c.Attribute(regionAttribute)
+    return region
+}
+
+// Returns the names of the regions of the world, sorted.
+func (w *WorldX) Regions() []string {
+    var regions []string
+    cities := w.regionCities()
+    for region := range cities {
+        regions = append(regions, region)
+    }
+    for region := range w.regions {
+        if _, ok := cities[region]; !ok {
+            regions = append(regions, region)
+        }
+    }
+    sort.Strings(regions)
+    return regions
+}
+
+// Returns the statistics of every region of the world, sorted by name.
+func (w *WorldX) RegionStats() []RegionStats {
+    cities := w.regionCities()
+    stats := make([]RegionStats, 0, len(cities))
+    for _, region := range w.Regions() {
+        s := RegionStats{Name: region, InitialCities: cities[region], Cities: cities[region], FirstFall: -1}
+        if record, ok := w.regions[region]; ok {
+            s.InitialCities, s.DestroyedCities, s.FirstFall = record.initialCities, record.destroyedCities,
+                record.firstFall
+        }
+        for _, a := range w.Aliens {
+            if a.location != nil && a.location.Region() == region {
+                s.SurvivingAliens++
+            }
+        }
+        stats = append(stats, s)
+    }
+    return stats
+}
+
+// Returns the fraction of the initial cities of the region left, 1 for regions without cities.
+func (s RegionStats) SurvivalRate() float64 {
+    if s.InitialCities == 0 {
+        return 1
+    }
+    return float64(s.Cities) / float64(s.InitialCities)
+}
+
+func (s RegionStats) String() string {
+    str := fmt.Sprintf("%s: %d of %d cities left, %d destroyed, %d aliens left", formatName(s.Name), s.Cities,
+        s.InitialCities, s.DestroyedCities, s.SurvivingAliens)
+    if s.FirstFall >= 0 {
+        str += fmt.Sprintf(", first city fell in iteration %d", s.FirstFall)
+    }
+    return str
+}
+
+// Returns the world map with only the cities of the regions and the roads and portals between them, which can be
+// read back by ReadWorldMap. See String.
+func (w *WorldX) RegionString(regions ...string) (wStr string) {
+    include := inRegions(regions)
+    wStr = w.mapHeader()
+    for _, city := range w.sortedCities() {
+        if include(city) {
+            wStr += city.format(include, true) + "\n"
+        }
+    }
+    return
+}
+
+// Returns a filter of the cities in any of the regions, or of every city if there are no regions.
+func inRegions(regions []string) func(*City) bool {
+    if len(regions) == 0 {
+        return func(*City) bool { return true }
+    }
+
+    set := make(map[string]bool, len(regions))
+    for _, region := range regions {
+        set[region] = true
+    }
+    return func(c *City) bool { return set[c.Region()] }
+}
+
+// Returns the number of cities of each region of the world.
+func (w *WorldX) regionCities() map[string]int {
+    cities := make(map[string]int)
+    for _, city := range w.Cities {
+        if region := city.Region(); region != "" {
+            cities[region]++
+        }
+    }
+    return cities
+}
+
+// Remembers the cities of the regions the world didn't have when previous simulations started.
+func (w *WorldX) recordRegions() {
+    if w.regions == nil {
+        w.regions = make(map[string]*regionRecord)
+    }
+    for region, cities := range w.regionCities() {
+        if _, ok := w.regions[region]; !ok {
+            w.regions[region] = &regionRecord{initialCities: cities, firstFall: -1}
+        }
+    }
+}
+
+// Counts the destroyed city in its region, remembering the iteration if it's the first to fall.
+func (w *WorldX) recordFall(city *City) {
+    region := city.Region()
+    if region == "" {
+        return
+    }
+
+    w.recordRegions()
+    record := w.regions[region]
+    if record.destroyedCities++; record.firstFall < 0 {
+        record.firstFall = w.iteration
+    }
+}
@@ -0,0 +1,53 @@
+package worldx
+
+import (
+    "bufio"
+    "strconv"
+)
+
+// Aliens in a city spawn a child into a random empty city connected to theirs every options.SpawnEvery iterations
+// they survive, as long as they're fewer than options.PopulationCap. Defenders don't spawn.
+func (w *WorldX) spawnAliens(writer *bufio.Writer) {
+    if w.options.SpawnEvery <= 0 {
+        return
+    }
+
+    for _, parent := range sortedUnits(w.Aliens) {
+        if parent.age++; parent.age%w.options.SpawnEvery != 0 || parent.location == nil {
+            continue
+        } else if populationCap := w.options.PopulationCap; populationCap > 0 && len(w.Aliens) >= populationCap {
+            continue
+        }
+
+        var emptyCities []string
+        for _, road := range parent.location.Roads() {
+            if road.Destination.alien == nil {
+                emptyCities = append(emptyCities, road.Destination.name)
+            }
+        }
+        if len(emptyCities) == 0 {
+            continue
+        }
+
+        city := emptyCities[w.rng.Intn(len(emptyCities))]
+        child := w.spawnAlien(parent, city)
+        w.emit(writer, Event{Type: AlienSpawned, City: city, Aliens: []string{parent.name, child.name},
+            Faction: parent.faction})
+    }
+}
+
+// Creates a child of the alien in the empty city, of the same faction and with the same strategy.
+func (w *WorldX) spawnAlien(parent *Alien, city string) *Alien {
+    child := w.CreateAlien(strconv.Itoa(w.nextAlienID), []string{city})
+    w.initializeAlien(child)
+    child.strategy = parent.strategy
+    return child
+}
+
+// Keeps the name from being given to a child if it's a number, so children are named after the highest number any
+// alien or defender of the world was ever named with and never take the name of an alien that died.
+func (w *WorldX) reserveAlienName(name string) {
+    if id, err := strconv.Atoi(name); err == nil && id >= w.nextAlienID {
+        w.nextAlienID = id + 1
+    }
+}
@@ -0,0 +1,125 @@
+package worldx
+
+import (
+    "bufio"
+    "sort"
+)
+
+// Destroyed city remembered by the world so it can be rebuilt with its original roads.
+type ruin struct {
+    name       string
+    attributes map[string]string
+    roads      []ruinedRoad // Roads that left and reached the city when it was destroyed
+    rebuildIn  int          // Iterations left until the city is rebuilt
+}
+
+// Road of a destroyed city, from the city in the direction or to it from the neighbour.
+type ruinedRoad struct {
+    neighbour string
+    dir       Direction
+    length    int
+    incoming  bool // The road leaves the neighbour in the direction, instead of leaving the city
+    portal    bool // The road is a portal between the city and the neighbour, without direction
+}
+
+// Returns the names of the destroyed cities the world remembers, sorted.
+func (w *WorldX) Ruins() []string {
+    names := make([]string, 0, len(w.ruins))
+    for _, r := range w.ruins {
+        names = append(names, r.name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// Remembers the city and its roads before it's deleted, if the simulation rebuilds destroyed cities.
+func (w *WorldX) recordRuin(city *City) {
+    if w.options.RebuildAfter <= 0 {
+        return
+    }
+
+    r := &ruin{name: city.name, attributes: city.Attributes(), rebuildIn: w.options.RebuildAfter}
+    for dir, connection := range city.connectedCities {
+        if connection != nil {
+            r.roads = append(r.roads, ruinedRoad{neighbour: connection.name, dir: Direction(dir),
+                length: city.roadLengths[dir]})
+        }
+    }
+    for neighbour := range city.incoming {
+        for dir, connection := range neighbour.connectedCities {
+            if connection == city {
+                r.roads = append(r.roads, ruinedRoad{neighbour: neighbour.name, dir: Direction(dir),
+                    length: neighbour.roadLengths[dir], incoming: true})
+            }
+        }
+    }
+    for _, portal := range city.portals {
+        r.roads = append(r.roads, ruinedRoad{neighbour: portal.name, portal: true})
+    }
+    w.ruins = append(w.ruins, r)
+}
+
+// Rebuilds the ruins whose time has come if options.RebuildAfter is set, and the names aren't taken by new cities.
+func (w *WorldX) rebuildRuins(writer *bufio.Writer) {
+    if w.options.RebuildAfter <= 0 {
+        return
+    }
+
+    ruins := w.ruins[:0]
+    for _, r := range w.ruins {
+        if r.rebuildIn--; r.rebuildIn > 0 {
+            ruins = append(ruins, r)
+        } else if _, ok := w.Cities[r.name]; ok {
+            continue
+        } else {
+            w.rebuildCity(r)
+            w.rebuiltCities++
+            w.emit(writer, Event{Type: CityRebuilt, City: r.name})
+        }
+    }
+    w.ruins = ruins
+}
+
+// Creates the city again with its attributes and the roads and portals to the neighbours that still exist. Roads to
+// neighbours waiting to be rebuilt are kept by their ruins, and restored when they're rebuilt too.
+func (w *WorldX) rebuildCity(r *ruin) {
+    city := w.CreateCity(r.name)
+    for key, value := range r.attributes {
+        city.SetAttribute(key, value)
+    }
+
+    for _, road := range r.roads {
+        neighbour, ok := w.Cities[road.neighbour]
+        if !ok {
+            w.keepRuinedRoad(r.name, road)
+            continue
+        }
+
+        if road.portal {
+            w.AddPortal(city, neighbour)
+            continue
+        }
+
+        from, to := city, neighbour
+        if road.incoming {
+            from, to = neighbour, city
+        }
+        if from.Connection(road.dir) == nil {
+            from.setConnection(road.dir, to, road.length)
+            if from.alien != nil {
+                from.alien.isTrapped = false
+            }
+        }
+    }
+}
+
+// Adds the road of the rebuilt city to the ruin of its neighbour, if the neighbour is waiting to be rebuilt.
+func (w *WorldX) keepRuinedRoad(name string, road ruinedRoad) {
+    for _, r := range w.ruins {
+        if r.name == road.neighbour {
+            r.roads = append(r.roads, ruinedRoad{neighbour: name, dir: road.dir, length: road.length,
+                incoming: !road.incoming, portal: road.portal})
+            return
+        }
+    }
+}
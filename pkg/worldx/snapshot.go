@@ -0,0 +1,64 @@
+package worldx
+
+// Immutable copy of the state of the world at one iteration of a simulation, observers can keep it without racing
+// with the simulation since it doesn't share memory with the world.
+type Snapshot struct {
+    Iteration int
+    Cities    []CitySnapshot  // Cities of the world sorted by name
+    Aliens    []AlienSnapshot // Aliens and defenders of the world sorted by faction and name
+    Summary   Summary
+}
+
+// State of a city in a Snapshot.
+type CitySnapshot struct {
+    Name     string
+    Line     string // Line of the city in the world map, with its roads, portals and attributes
+    Alien    string // Name of the alien or defender in the city, empty if there's none
+    Damage   int
+    Region   string
+    Isolated bool
+}
+
+// State of an alien or defender in a Snapshot.
+type AlienSnapshot struct {
+    Name      string
+    Faction   Faction
+    City      string // City where the alien is, empty while travelling
+    From      string // City the alien left, empty if it isn't travelling
+    To        string // City the alien is travelling to, empty if it isn't travelling
+    Remaining int    // Iterations left until the alien arrives
+    Trapped   bool
+    Exhausted bool
+    Health    int
+    Energy    int
+}
+
+// Returns a snapshot of the current state of the world.
+func (w *WorldX) Snapshot() Snapshot {
+    snapshot := Snapshot{Iteration: w.iteration, Summary: w.Summary()}
+
+    cities := w.sortedCities()
+    snapshot.Cities = make([]CitySnapshot, len(cities))
+    for i, c := range cities {
+        snapshot.Cities[i] = CitySnapshot{Name: c.name, Line: c.String(), Damage: c.damage, Region: c.Region(),
+            Isolated: c.IsIsolated()}
+        if c.alien != nil {
+            snapshot.Cities[i].Alien = c.alien.name
+        }
+    }
+
+    for _, units := range []map[string]*Alien{w.Aliens, w.Defenders} {
+        for _, a := range sortedUnits(units) {
+            s := AlienSnapshot{Name: a.name, Faction: a.faction, Trapped: a.isTrapped, Exhausted: a.isExhausted,
+                Health: a.health, Energy: a.energy}
+            if a.location != nil {
+                s.City = a.location.name
+            }
+            if a.transit != nil {
+                s.From, s.To, s.Remaining = a.transit.from.name, a.transit.to.name, a.transit.remaining
+            }
+            snapshot.Aliens = append(snapshot.Aliens, s)
+        }
+    }
+    return snapshot
+}
@@ -0,0 +1,34 @@
+package worldx
+
+import "math/rand"
+
+// Road leaving a city that an alien can take.
+type Road struct {
+    Direction   Direction // Direction of the road, UnknownDirection for portals
+    Destination *City
+    Length      int       // Iterations to travel the road
+    Cost        int       // Energy spent to take the road, from the `cost` attribute of the destination
+    Portal      bool      // The road is a portal, without direction
+}
+
+// Chooses where an alien moves next, e.g. reading its Energy() to prefer cheaper roads.
+type MovementStrategy interface {
+    // Returns the index of the road the alien takes, or -1 to stay in its city this iteration.
+    // Roads only contains the roads the alien has energy to take and is never empty, random choices should come
+    // from rng, the random source of the simulation.
+    NextMove(alien *Alien, roads []Road, rng *rand.Rand) int
+}
+
+// Adapter to use an ordinary function as a MovementStrategy.
+type MovementStrategyFunc func(alien *Alien, roads []Road, rng *rand.Rand) int
+
+func (f MovementStrategyFunc) NextMove(alien *Alien, roads []Road, rng *rand.Rand) int {
+    return f(alien, roads, rng)
+}
+
+// Moves aliens through a random road, the default strategy.
+type RandomStrategy struct{}
+
+func (RandomStrategy) NextMove(_ *Alien, roads []Road, rng *rand.Rand) int {
+    return rng.Intn(len(roads))
+}
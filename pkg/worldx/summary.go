@@ -0,0 +1,51 @@
+package worldx
+
+import "fmt"
+
+// Summary of the state of the world, e.g. at the end of a simulation.
+type Summary struct {
+    Cities           int // Cities left in the world
+    DestroyedCities  int // Cities destroyed by the simulations run in the world
+    RebuiltCities    int // Destroyed cities rebuilt by the simulations run in the world
+    Aliens           int // Aliens alive
+    TrappedAliens    int // Aliens that can't leave their city or are stranded on a road
+    ExhaustedAliens  int // Aliens without energy to take any road
+    TravellingAliens int // Aliens on a road between two cities
+    Defenders        int // Defenders alive
+    SavedCities      int // Cities left where defenders stopped aliens, to compare with the destroyed ones
+}
+
+// Returns the summary of the current state of the world.
+func (w *WorldX) Summary() (summary Summary) {
+    summary.Cities, summary.DestroyedCities, summary.RebuiltCities = len(w.Cities), w.destroyedCities, w.rebuiltCities
+    summary.Aliens = len(w.Aliens)
+    for _, a := range w.Aliens {
+        if a.isTrapped {
+            summary.TrappedAliens++
+        } else if a.isExhausted {
+            summary.ExhaustedAliens++
+        }
+        if a.transit != nil {
+            summary.TravellingAliens++
+        }
+    }
+
+    summary.Defenders = len(w.Defenders)
+    for name := range w.savedCities {
+        if _, ok := w.Cities[name]; ok {
+            summary.SavedCities++
+        }
+    }
+    return
+}
+
+func (s Summary) String() string {
+    str := fmt.Sprintf("%d cities left, %d destroyed, %d rebuilt; %d aliens left, %d trapped, %d exhausted, "+
+        "%d travelling", s.Cities, s.DestroyedCities, s.RebuiltCities, s.Aliens, s.TrappedAliens, s.ExhaustedAliens,
+        s.TravellingAliens)
+    if s.Defenders > 0 || s.SavedCities > 0 {
+        str += fmt.Sprintf("; %d defenders left, %d cities saved vs %d lost", s.Defenders, s.SavedCities,
+            s.DestroyedCities)
+    }
+    return str
+}
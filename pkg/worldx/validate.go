@@ -0,0 +1,75 @@
+package worldx
+
+import (
+    "fmt"
+    "sort"
+)
+
+// Checks the world is consistent, e.g. that roads lead to cities of the world in its directions, that bidirectional
+// roads have the same length both ways and that aliens are where their cities say. Only the cities of the regions are
+// checked if any is given. Returns an error for every problem found, nil if there are none.
+func (w *WorldX) Validate(regions ...string) (errs []error) {
+    include := inRegions(regions)
+    names := make([]string, 0, len(w.Cities))
+    for name := range w.Cities {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    for _, name := range names {
+        if city := w.Cities[name]; city == nil || city.name != name {
+            errs = append(errs, fmt.Errorf("city %s is registered with the name of another city", formatName(name)))
+            continue
+        } else if !include(city) {
+            continue
+        } else if name == "" {
+            errs = append(errs, fmt.Errorf("city without name"))
+        }
+        errs = append(errs, w.validateCity(w.Cities[name])...)
+    }
+
+    for _, units := range []map[string]*Alien{w.Aliens, w.Defenders} {
+        for _, a := range sortedUnits(units) {
+            if a.location != nil && include(a.location) && a.location.alien != a {
+                errs = append(errs, fmt.Errorf("%v %s is in %s but the city has another alien", a.faction, a.name,
+                    formatName(a.location.name)))
+            }
+        }
+    }
+    return
+}
+
+func (w *WorldX) validateCity(city *City) (errs []error) {
+    name := formatName(city.name)
+    for dir, connection := range city.connectedCities {
+        if connection == nil {
+            continue
+        } else if !w.HasDirection(Direction(dir)) {
+            errs = append(errs, fmt.Errorf("road %v of %s is in a direction the world doesn't have", Direction(dir),
+                name))
+        } else if w.Cities[connection.name] != connection {
+            errs = append(errs, fmt.Errorf("road %v of %s leads to %s, which isn't in the world", Direction(dir),
+                name, formatName(connection.name)))
+        } else if length := city.roadLengths[dir]; length < 1 {
+            errs = append(errs, fmt.Errorf("road %v of %s has invalid length %d", Direction(dir), name, length))
+        } else if opposite := Direction(dir).GetOpposite(); connection.Connection(opposite) == city &&
+            connection.RoadLength(opposite) != length {
+            errs = append(errs, fmt.Errorf("road %v of %s is %d long but the road back is %d long", Direction(dir),
+                name, length, connection.RoadLength(opposite)))
+        }
+    }
+
+    for _, portal := range city.portals {
+        if w.Cities[portal.name] != portal {
+            errs = append(errs, fmt.Errorf("portal of %s leads to %s, which isn't in the world", name,
+                formatName(portal.name)))
+        } else if !portal.HasPortal(city) {
+            errs = append(errs, fmt.Errorf("portal of %s to %s doesn't lead back", name, formatName(portal.name)))
+        }
+    }
+
+    if a := city.alien; a != nil && (a.location != city || w.units(a.faction)[a.name] != a) {
+        errs = append(errs, fmt.Errorf("%s has %v %s, which isn't in the city or the world", name, a.faction, a.name))
+    }
+    return
+}
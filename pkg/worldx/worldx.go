@@ -3,64 +3,156 @@ package worldx
 import (
     "bufio"
     "fmt"
+    "io"
     "log"
     "math/rand"
+    "sort"
     "strconv"
     "strings"
     "time"
 )
 
 type WorldX struct {
-    Cities map[string]*City  // Maps city name to pointer of respective city
-    Aliens map[string]*Alien // Maps alien name to pointer of respective alien
+    Cities    map[string]*City  // Maps city name to pointer of respective city
+    Aliens    map[string]*Alien // Maps alien name to pointer of respective alien
+    Defenders map[string]*Alien // Maps defender name to pointer of respective defender, see CreateDefender
+
+    directions     []Direction          // Directions roads can take in this world, nil for the cardinal directions
+    directionNames map[string]Direction // Lower case names and aliases of the directions declared by this world
+    options        SimulationOptions    // Options of the simulation running in this world
+    iteration      int                  // Iteration of the simulation running in this world
+
+    completedIterations int  // Iterations the last simulation of this world completed
+    resumed             bool // The world was read from a checkpoint and the next simulation continues it
+
+    destroyedCities int                      // Cities destroyed by the simulations run in this world
+    rebuiltCities   int                      // Cities rebuilt by the simulations run in this world
+    ruins           []*ruin                  // Destroyed cities, in the order they were destroyed
+    rng             *rand.Rand               // Random generator of the simulation running in this world
+    source          *randomSource            // Random source of rng
+    savedCities     map[string]bool          // Cities where defenders stopped aliens
+    nextAlienID     int                      // Number after the highest name of an alien or defender ever in the world
+    regions         map[string]*regionRecord // Cities of each region when simulations started and how they fell
+    annotations     *mapAnnotations          // Comments and directives of the maps read into the world
 }
 
-func (w *WorldX) String() (wStr string) {
-    for _, c := range w.Cities {
-        wStr += c.String() + "\n"
+// Returns the directions roads can take in this world, by default north, south, east and west.
+func (w *WorldX) Directions() []Direction {
+    if w.directions == nil {
+        return append([]Direction(nil), defaultDirections...)
     }
+    return append([]Direction(nil), w.directions...)
+}
 
-    return
+// Sets the directions roads can take in this world, existing connections in other directions are kept.
+// Panics if any of the directions isn't valid.
+func (w *WorldX) SetDirections(dirs ...Direction) {
+    for _, dir := range dirs {
+        if !dir.IsValid() {
+            log.Panicf("SetDirections: invalid direction %v.", dir)
+        }
+    }
+    w.directions = append([]Direction(nil), dirs...)
 }
 
-// Reads map of World X from the provided scanner and populates world with the cities and connections described.
-// Panics if errors occur while reading the scanner or creating the cities and connections.
-func (w *WorldX) ReadWorldMap(scanner *bufio.Scanner) {
-    const defaultDirectionSeparator string = "="
+// Returns true if roads can take the direction in this world.
+func (w *WorldX) HasDirection(dir Direction) bool {
+    return containsDirection(w.Directions(), dir)
+}
 
-    for scanner.Scan() {
-        var newCity *City
-        cityDetails := strings.Fields(scanner.Text())
+// Returns the world map in canonical form, one city per line sorted by name, which can be read back by ReadWorldMap.
+// The header with the directions of the world is only written if they aren't the default cardinal directions.
+// Comments and directives of the maps read into the world are kept, comments with the line after them, the header as
+// written while the world keeps its directions, and `%region` directives after the cities.
+func (w *WorldX) String() string {
+    a := w.annotations
+    if a == nil {
+        a = &mapAnnotations{}
+    }
+    regions, listed := a.regionLines(w)
 
-        for i, value := range cityDetails {
-            if i == 0 {
-                newCity = w.CreateCity(value)
-            } else if newCity != nil {
-                directionDetails := strings.SplitN(value, defaultDirectionSeparator, 2)
-                dir := GetDirection(directionDetails[0])
+    var wStr strings.Builder
+    writeLines := func(lines []string) {
+        for _, line := range lines {
+            wStr.WriteString(line + "\n")
+        }
+    }
+    writeLines(a.headerLines(w))
+    for _, city := range w.sortedCities() {
+        writeLines(a.cityComments[city.name])
+        wStr.WriteString(city.format(nil, !listed[city.name]))
+        if comments := a.lineComments[city.name]; len(comments) > 0 {
+            wStr.WriteString(" " + strings.Join(comments, " "))
+        }
+        wStr.WriteString("\n")
+    }
+    for _, region := range regions {
+        writeLines(region.comments)
+        writeLines([]string{region.String()})
+    }
+    writeLines(a.trailer)
+    return wStr.String()
+}
 
-                // Ignore directions without city name, with empty city name, and invalid directions
-                if len(directionDetails) == 2 && len(directionDetails[1]) > 0 && dir.IsValid() {
+// Returns the cities of the world sorted by name, so random choices only depend on the random source.
+func (w *WorldX) sortedCities() []*City {
+    names := make([]string, 0, len(w.Cities))
+    for name := range w.Cities {
+        names = append(names, name)
+    }
+    sort.Strings(names)
 
-                    // Only add connection if it doesn't exist yet, duplicated connections are ignored
-                    if newCity.connectedCities[dir] == nil {
-                        connectedCity := w.CreateCity(directionDetails[1])
-                        w.AddConnection(newCity, connectedCity, dir)
-                    }
-                }
-            }
-        }
+    cities := make([]*City, len(names))
+    for i, name := range names {
+        cities[i] = w.Cities[name]
     }
+    return cities
+}
 
-    if err := scanner.Err(); err != nil {
+// Reads map of World X from the provided reader and populates world with the cities and connections described.
+// Panics if errors occur while reading the map or creating the cities and connections.
+func (w *WorldX) ReadWorldMap(reader io.Reader) {
+    if _, err := w.ReadWorldMapWithOptions(reader, ReadOptions{}); err != nil {
         log.Panic(err)
     }
 }
 
-// Generates aliens one at a time placing them in a random empty city.
-// Panics on the tentative to generate more aliens than the number of cities.
+// Reads map of World X from the provided reader and populates world with the cities and connections described.
+// The map is streamed line by line and may be compressed with gzip or zstd, which is detected from its first bytes.
+// City names may be written between double quotes to include spaces, blank lines are ignored, `#` comments are kept
+// to be written back by String, and the first line may be a `%worldx <version>` header. Directions are matched
+// ignoring case and may be written with aliases, e.g. `N=` for `north=`.
+// Returns the diagnostics of the lines read, such as directions written with aliases or roads that conflict with
+// each other, and an error if reading the map fails or one of its lines is invalid.
+func (w *WorldX) ReadWorldMapWithOptions(reader io.Reader, options ReadOptions) ([]Diagnostic, error) {
+    lines, closeLines, err := decompressMap(reader)
+    if err != nil {
+        return nil, fmt.Errorf("ReadWorldMap: %w", err)
+    }
+    defer closeLines()
+
+    state := mapReader{world: w, options: options}
+    for {
+        line, err := readMapLine(lines, options.MaxLineLength)
+        if err == io.EOF {
+            state.annotateEnd()
+            return state.diagnostics, nil
+        }
+        state.lineNumber++
+        if err != nil {
+            return state.diagnostics, fmt.Errorf("ReadWorldMap: line %d: %w", state.lineNumber, err)
+        }
+
+        if err := state.readLine(line); err != nil {
+            return state.diagnostics, fmt.Errorf("ReadWorldMap: line %d: %w", state.lineNumber, err)
+        }
+    }
+}
+
+// Generates aliens one at a time placing them in a random empty city, chosen with the random source of the world if
+// it was seeded with SetSeed. Panics on the tentative to generate more aliens than the number of cities.
 func (w *WorldX) GenerateAliens(numberAliens int) {
-    if totalAliens, totalCities := len(w.Aliens)+numberAliens, len(w.Cities); numberAliens < 0 {
+    if totalAliens, totalCities := len(w.Aliens)+len(w.Defenders)+numberAliens, len(w.Cities); numberAliens < 0 {
         log.Panicf("GenerateAliens: the number of aliens to be generated need to be positive.")
     } else if totalAliens > totalCities {
         log.Panicf(
@@ -76,24 +168,132 @@ func (w *WorldX) GenerateAliens(numberAliens int) {
             emptyCities = append(emptyCities, name)
         }
     }
+    sort.Strings(emptyCities)
 
-    rand.Seed(time.Now().UnixNano())
+    if w.rng == nil {
+        rand.Seed(time.Now().UnixNano())
+    }
     for alienIndex := 0; alienIndex < numberAliens; alienIndex++ {
         alienName := strconv.Itoa(alienIndex)
         w.CreateAlien(alienName, emptyCities)
     }
 }
 
+// Options of the simulation of an invasion, the zero value simulates the original invasion rules.
+type SimulationOptions struct {
+    MaxIterations        int              // Iterations to simulate, 0 for defaultMaxIterations
+    HeadOnCollisions     bool             // Aliens travelling the same road in opposite directions fight when they meet
+    CityDefense          int              // Defense of cities without a `defense` attribute, 0 for 1 (one fight)
+    AlienHealth          int              // Fights new aliens survive, 0 for 1
+    AlienEnergy          int              // Energy new aliens have to spend taking roads, 0 for unlimited
+    Strategy             MovementStrategy // Strategy of aliens without their own, nil for RandomStrategy
+    DefenderStrategy     MovementStrategy // Strategy of defenders without their own, nil for HuntingStrategy
+    DefenseOutcome       DefenseOutcome   // Who dies when an alien meets a defender, by default the alien
+    SpawnEvery           int              // Iterations an alien survives between spawning children, 0 to never spawn
+    PopulationCap        int              // Aliens that stop them from spawning, 0 for no cap
+    RebuildAfter         int              // Iterations until destroyed cities are rebuilt, 0 to never rebuild them
+    BridgeCollapseChance float64          // Probability that a random road collapses every iteration
+    QuarantineChance     float64          // Probability that a random city loses all its roads every iteration
+    Seed                 int64            // Seed of the random source of the simulation, 0 for a random seed
+    OnEvent              func(Event)      // Called with every event of the simulation, after it's printed
+    OnIteration          func(Snapshot)   // Called with a snapshot of the world at the end of every iteration
+    CheckpointEvery      int              // Iterations between calls to OnCheckpoint, 0 to never call it
+    OnCheckpoint         func(*WorldX)    // Called with the world between iterations, e.g. to WriteCheckpoint
+}
+
+func (o SimulationOptions) maxIterations() int {
+    const defaultMaxIterations int = 10000
+
+    if o.MaxIterations > 0 {
+        return o.MaxIterations
+    }
+    return defaultMaxIterations
+}
+
+// Returns the defense of the city, from its `defense` attribute or the default of the simulation.
+// A city is destroyed when the damage of the fights in it reaches its defense, so it's never less than 1.
+func (o SimulationOptions) cityDefense(city *City) int {
+    defense := o.CityDefense
+    if defense < 1 {
+        defense = 1
+    }
+    if defense = city.IntAttribute(defenseAttribute, defense); defense < 1 {
+        return 1
+    }
+    return defense
+}
+
+func (o SimulationOptions) alienHealth() int {
+    if o.AlienHealth > 0 {
+        return o.AlienHealth
+    }
+    return 1
+}
+
+func (o SimulationOptions) alienEnergy() int {
+    if o.AlienEnergy > 0 {
+        return o.AlienEnergy
+    }
+    return UnlimitedEnergy
+}
+
 // Simulates invasion moving each alien `defaultMaxIterations` times or until it's trapped in an isolated city.
 // When two aliens meet in the same city they fight and in the process, both aliens die and the city is destroyed
 // severing all its connections. Prints message to the writer for every city destroyed.
 func (w *WorldX) RunSimulation(writer *bufio.Writer) {
-    const defaultMaxIterations int = 10000
+    w.RunSimulationWithOptions(writer, SimulationOptions{})
+}
 
-    rand.Seed(time.Now().UnixNano())
-    for iteration := 0; iteration < defaultMaxIterations; iteration++ {
-        for _, a := range w.Aliens {
-            w.moveAlien(a, writer)
+// Simulates invasion with the provided options, see RunSimulation. Simulations with the same seed in the same world
+// have the same result, without a seed they continue with the random source of the world. The first simulation of a
+// world read with ReadCheckpoint continues the simulation it was taken from, from the iteration after the checkpoint
+// and with its random source, ignoring the seed of the options.
+// Aliens take as many iterations to travel a road as its length, while travelling they aren't in any city and only
+// fight when they arrive, or on the road if options.HeadOnCollisions is set. Aliens that take part in the first
+// simulation of the world get the health and energy of the options, every fight costs them 1 health and every road
+// they take costs them energy, an alien without energy for any road is exhausted and stops. Disasters can cut a random
+// road or all the roads of a random city every iteration.
+// Prints message to the writer for every event of the simulation.
+func (w *WorldX) RunSimulationWithOptions(writer *bufio.Writer, options SimulationOptions) {
+    w.options = options
+    for _, a := range w.Aliens {
+        w.initializeAlien(a)
+    }
+    w.recordRegions()
+
+    start := 0
+    if w.resumed {
+        start, w.resumed = w.completedIterations, false
+    } else if options.Seed != 0 {
+        w.SetSeed(options.Seed)
+    }
+    if w.rng == nil {
+        w.SetSeed(time.Now().UnixNano())
+    }
+
+    for w.iteration = start; w.iteration < options.maxIterations(); w.iteration++ {
+        w.rebuildRuins(writer)
+        w.strikeDisasters(writer)
+        for _, units := range []map[string]*Alien{w.Aliens, w.Defenders} {
+            for _, a := range sortedUnits(units) {
+                // Skip aliens destroyed earlier in the iteration
+                if units[a.name] == a {
+                    w.moveAlien(a, writer)
+                }
+            }
+        }
+        w.spawnAliens(writer)
+        w.completedIterations = w.iteration + 1
+
+        if w.options.OnIteration != nil {
+            w.options.OnIteration(w.Snapshot())
+        }
+        if every := w.options.CheckpointEvery; every > 0 && w.options.OnCheckpoint != nil &&
+            w.completedIterations%every == 0 {
+            w.options.OnCheckpoint(w)
+        }
+        if w.isQuiet() {
+            break
         }
     }
 
@@ -102,6 +302,56 @@ func (w *WorldX) RunSimulation(writer *bufio.Writer) {
     }
 }
 
+// Seeds the random source of the world, used to place aliens and by simulations without a seed of their own.
+func (w *WorldX) SetSeed(seed int64) {
+    w.source = &randomSource{}
+    w.source.Seed(seed)
+    w.rng = rand.New(w.source)
+}
+
+// Returns true if nothing can happen anymore in the simulation, every alien and defender is trapped or exhausted
+// and no city will be rebuilt, struck by a disaster or get a new alien.
+func (w *WorldX) isQuiet() bool {
+    if w.options.SpawnEvery > 0 || w.options.BridgeCollapseChance > 0 || w.options.QuarantineChance > 0 ||
+        w.options.RebuildAfter > 0 && len(w.ruins) > 0 {
+        return false
+    }
+
+    for _, a := range w.allUnits() {
+        if !a.isTrapped && !a.isExhausted {
+            return false
+        }
+    }
+    return true
+}
+
+// Returns the aliens sorted by name, so they move in the same order in every simulation.
+func sortedUnits(units map[string]*Alien) []*Alien {
+    names := make([]string, 0, len(units))
+    for name := range units {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    aliens := make([]*Alien, len(names))
+    for i, name := range names {
+        aliens[i] = units[name]
+    }
+    return aliens
+}
+
+// Prints the event to the writer and notifies the observer of the simulation.
+func (w *WorldX) emit(writer *bufio.Writer, event Event) {
+    event.Iteration = w.iteration
+    if _, err := fmt.Fprintln(writer, event.String()); err != nil {
+        log.Panic(err)
+    }
+
+    if w.options.OnEvent != nil {
+        w.options.OnEvent(event)
+    }
+}
+
 // Creates and adds city to the world if it doesn't exist yet, returns pointer to city with requested name.
 func (w *WorldX) CreateCity(cityName string) *City {
     if w.Cities == nil {
@@ -113,7 +363,7 @@ func (w *WorldX) CreateCity(cityName string) *City {
     } else {
         newCity := City{
             name:            cityName,
-            connectedCities: [MaxDirections]*City{},
+            connectedCities: nil,
             alien:           nil,
         }
         w.Cities[cityName] = &newCity
@@ -122,16 +372,18 @@ func (w *WorldX) CreateCity(cityName string) *City {
 }
 
 // Add bidirectional connection between city1 and city2.
-// Panics if any of the cities doesn't exist or the direction isn't valid.
+// Panics if any of the cities doesn't exist or the direction isn't valid or one of the directions of the world.
 func (w *WorldX) AddConnection(city1 *City, city2 *City, dir Direction) {
     if city1 == nil || city2 == nil {
         log.Panicln("AddConnection: city doesn't exist, cannot create connection if either city is <nil>.")
     } else if !dir.IsValid() {
-        log.Printf("AddConnection: invalid direction %v.", dir)
+        log.Panicf("AddConnection: invalid direction %v.", dir)
+    } else if !w.HasDirection(dir) || !w.HasDirection(dir.GetOpposite()) {
+        log.Panicf("AddConnection: the world doesn't have direction %v or its opposite.", dir)
     }
 
-    city1.connectedCities[dir] = city2
-    city2.connectedCities[dir.GetOpposite()] = city1
+    city1.setConnection(dir, city2, 1)
+    city2.setConnection(dir.GetOpposite(), city1, 1)
 
     if city1.alien != nil && city1.alien.isTrapped {
         city1.alien.isTrapped = false
@@ -141,12 +393,54 @@ func (w *WorldX) AddConnection(city1 *City, city2 *City, dir Direction) {
     }
 }
 
+// Add one-way connection from city1 to city2, aliens can only travel from city1 to city2 through it.
+// Panics if any of the cities doesn't exist or the direction isn't valid or one of the directions of the world.
+func (w *WorldX) AddOneWayConnection(city1 *City, city2 *City, dir Direction) {
+    if city1 == nil || city2 == nil {
+        log.Panicln("AddOneWayConnection: city doesn't exist, cannot create connection if either city is <nil>.")
+    } else if !dir.IsValid() {
+        log.Panicf("AddOneWayConnection: invalid direction %v.", dir)
+    } else if !w.HasDirection(dir) {
+        log.Panicf("AddOneWayConnection: the world doesn't have direction %v.", dir)
+    }
+
+    city1.setConnection(dir, city2, 1)
+
+    if city1.alien != nil && city1.alien.isTrapped {
+        city1.alien.isTrapped = false
+    }
+}
+
+// Sets the number of iterations aliens take to travel the road leaving the city in the direction, and the road back
+// if it's bidirectional. Panics if there's no road in the direction or the length isn't positive.
+func (w *WorldX) SetRoadLength(city *City, dir Direction, length int) {
+    connectedCity := city.Connection(dir)
+    if connectedCity == nil {
+        log.Panicf("SetRoadLength: there's no road from %s to the %v.", city.name, dir)
+    } else if length < 1 {
+        log.Panicf("SetRoadLength: invalid road length %d, should be positive.", length)
+    }
+
+    city.roadLengths[dir] = length
+    if opposite := dir.GetOpposite(); connectedCity.Connection(opposite) == city {
+        connectedCity.roadLengths[opposite] = length
+    }
+}
+
+// Returns a random number in [0, n) from the random source of the world, or the global one if it isn't seeded.
+func (w *WorldX) intn(n int) int {
+    if w.rng != nil {
+        return w.rng.Intn(n)
+    }
+    return rand.Intn(n)
+}
+
 // Returns pointer to random city without an alien.
 // Empty cities slice should contain at least one empty city, otherwise enters an infinite loop.
 func (w *WorldX) getRandomEmptyCity(emptyCities []string) (randomEmptyCity *City) {
     totalEmptyCities := len(emptyCities)
     for {
-        randomEmptyCity = w.Cities[emptyCities[rand.Intn(totalEmptyCities)]]
+        randomEmptyCity = w.Cities[emptyCities[w.intn(totalEmptyCities)]]
 
         if randomEmptyCity.alien == nil {
             return
@@ -155,12 +449,16 @@ func (w *WorldX) getRandomEmptyCity(emptyCities []string) (randomEmptyCity *City
 }
 
 // If alien doesn't exist, creates it in a random empty city and adds it to the world.
-// Returns pointer to alien with requested name.
+// Panics if a defender already has the name. Returns pointer to alien with requested name.
 func (w *WorldX) CreateAlien(alienName string, possibleEmptyCities []string) *Alien {
     if w.Aliens == nil {
         w.Aliens = make(map[string]*Alien)
     }
 
+    if _, ok := w.Defenders[alienName]; ok {
+        log.Panicf("CreateAlien: there's already a defender named %s.", alienName)
+    }
+
     if a, ok := w.Aliens[alienName]; ok {
         return a
     } else {
@@ -169,47 +467,199 @@ func (w *WorldX) CreateAlien(alienName string, possibleEmptyCities []string) *Al
             name:      alienName,
             location:  randomEmptyCity,
             isTrapped: randomEmptyCity.IsIsolated(),
+            health:    1,
+            energy:    UnlimitedEnergy,
         }
         w.Aliens[alienName] = &newAlien
+        w.reserveAlienName(alienName)
         randomEmptyCity.alien = &newAlien
         return &newAlien
     }
 }
 
-// Moves alien from its current city to a random connected city if he isn't trapped,
-// if an alien is already present they fight and the city and both aliens are destroyed.
+// Sets the health and energy of the alien from the options of the simulation, unless it already took part in one.
+func (w *WorldX) initializeAlien(alien *Alien) {
+    if !alien.initialized {
+        alien.health, alien.energy, alien.initialized = w.options.alienHealth(), w.options.alienEnergy(), true
+    }
+}
+
+// Returns the strategy of the alien, or the strategy of the simulation for its faction if it doesn't have its own.
+func (w *WorldX) strategy(alien *Alien) MovementStrategy {
+    if alien.strategy != nil {
+        return alien.strategy
+    } else if alien.faction == DefenderFaction {
+        if w.options.DefenderStrategy != nil {
+            return w.options.DefenderStrategy
+        }
+        return HuntingStrategy{}
+    } else if w.options.Strategy != nil {
+        return w.options.Strategy
+    }
+    return RandomStrategy{}
+}
+
+// Moves alien from its current city through the road chosen by its strategy if he isn't trapped or exhausted,
+// or along the road it's travelling. If an alien is already present in the city it arrives they fight.
 func (w *WorldX) moveAlien(alien *Alien, writer *bufio.Writer) {
     if alien.isTrapped {
         return
+    } else if alien.transit != nil {
+        if alien.transit.remaining--; alien.transit.remaining <= 0 {
+            w.arriveAlien(alien, alien.transit.to, writer)
+        }
+        return
+    } else if alien.isExhausted {
+        return
     }
 
-    nextCity := alien.location.getRandomConnection()
-    if nextCity == nil {
+    roads := alien.location.Roads()
+    if len(roads) == 0 {
         alien.isTrapped = true
         return
-    } else if nextCity.alien != nil {
-        cityName, alien1Name, alien2Name := nextCity.name, alien.name, nextCity.alien.name
-        defer func() {
-            _, err := fmt.Fprintf(writer, "%s has been destroyed by alien %s and alien %s\n",
-                cityName, alien1Name, alien2Name)
-            if err != nil {
-                log.Panic(err)
-            }
-        }()
+    }
+
+    affordableRoads := make([]Road, 0, len(roads))
+    for _, road := range roads {
+        if alien.energy == UnlimitedEnergy || road.Cost <= alien.energy {
+            affordableRoads = append(affordableRoads, road)
+        }
+    }
+    if len(affordableRoads) == 0 {
+        alien.isExhausted = true
+        return
+    }
 
-        w.destroyCity(nextCity, alien, nextCity.alien)
+    choice := w.strategy(alien).NextMove(alien, affordableRoads, w.rng)
+    if choice < 0 || choice >= len(affordableRoads) {
+        return
+    }
+
+    road := affordableRoads[choice]
+    if alien.energy != UnlimitedEnergy {
+        if alien.energy -= road.Cost; alien.energy == 0 {
+            alien.isExhausted = true
+        }
+    }
+
+    if road.Length > 1 {
+        w.departAlien(alien, road, writer)
     } else {
-        alien.location.alien = nil
-        alien.location = nextCity
-        nextCity.alien = alien
-        if nextCity.IsIsolated() {
-            alien.isTrapped = true
+        w.arriveAlien(alien, road.Destination, writer)
+    }
+}
+
+// Puts alien on the road leaving its city. If options.HeadOnCollisions is set and another alien is
+// travelling the same road in the opposite direction they fight and both aliens are destroyed.
+func (w *WorldX) departAlien(alien *Alien, road Road, writer *bufio.Writer) {
+    from, to, length := alien.location, road.Destination, road.Length
+    from.alien, alien.location = nil, nil
+    alien.transit = &transit{from: from, to: to, length: length, remaining: length - 1}
+    w.emit(writer, Event{Type: AlienDeparted, Aliens: []string{alien.name}, From: from.name, To: to.name,
+        Length: length})
+
+    if !w.options.HeadOnCollisions || alien.faction == DefenderFaction {
+        return
+    }
+
+    // The alien meets first the alien travelling the other way closest to the city it left, the one with the fewest
+    // iterations left, and the first by name if several are as close so the same simulation always has the same result
+    var opponent *Alien
+    for _, other := range w.Aliens {
+        if t := other.transit; t == nil || t.from != to || t.to != from || other.isTrapped {
+            continue
+        } else if opponent == nil || t.remaining < opponent.transit.remaining ||
+            t.remaining == opponent.transit.remaining && other.name < opponent.name {
+            opponent = other
+        }
+    }
+    if opponent != nil {
+        w.emit(writer, Event{Type: AliensCollided, Aliens: []string{alien.name, opponent.name}, From: from.name,
+            To: to.name, Length: length})
+        w.deleteAlien(alien)
+        w.deleteAlien(opponent)
+    }
+}
+
+// Sends the travelling alien back to the city it left, taking the given iterations,
+// or strands it on the road if that city was destroyed.
+func (w *WorldX) turnBack(alien *Alien, remaining int) {
+    if from := alien.transit.from; w.Cities[from.name] == from {
+        alien.transit.from, alien.transit.to, alien.transit.remaining = alien.transit.to, from, remaining
+    } else {
+        alien.isTrapped = true
+    }
+}
+
+// Moves alien into the city, if an alien is already present they fight, or the city is defended if one of them is a
+// defender. Defenders don't fight each other, the one arriving is repelled.
+func (w *WorldX) arriveAlien(alien *Alien, city *City, writer *bufio.Writer) {
+    if occupant := city.alien; occupant != nil {
+        if occupant.faction != alien.faction {
+            w.defend(city, alien, writer)
+        } else if alien.faction == DefenderFaction {
+            w.repel(alien)
+        } else {
+            w.fight(city, alien, occupant, writer)
         }
+        return
+    }
+
+    if alien.location != nil {
+        alien.location.alien = nil
+    }
+    alien.location, alien.transit = city, nil
+    city.alien = alien
+    if city.IsIsolated() {
+        alien.isTrapped = true
+    }
+}
+
+// The aliens fighting in the city lose health and damage it, the city is destroyed with both aliens when the damage
+// reaches its defense. Otherwise aliens without health die, and if the alien in the city survives the attacker
+// is repelled, staying in its city or travelling back to it, or takes its place if it doesn't.
+func (w *WorldX) fight(city *City, attacker *Alien, occupant *Alien, writer *bufio.Writer) {
+    const fightDamage int = 1
+
+    city.damage += fightDamage
+    attacker.health -= fightDamage
+    occupant.health -= fightDamage
+
+    aliens := []string{attacker.name, occupant.name}
+    defense := w.options.cityDefense(city)
+    if city.damage >= defense {
+        w.emit(writer, Event{Type: CityDestroyed, City: city.name, Aliens: aliens, Damage: city.damage})
+        w.destroyCity(city, attacker, occupant)
+        return
+    }
+
+    w.emit(writer, Event{Type: CityDamaged, City: city.name, Aliens: aliens, Damage: fightDamage,
+        Defense: defense - city.damage})
+    if occupant.health <= 0 {
+        w.deleteAlien(occupant)
+    }
+    if attacker.health <= 0 {
+        w.deleteAlien(attacker)
+    } else if city.alien == nil {
+        w.arriveAlien(attacker, city, writer)
+    } else {
+        w.repel(attacker)
+    }
+}
+
+// Sends the alien that couldn't enter a city back where it came from, it stays in its city if it wasn't travelling.
+func (w *WorldX) repel(alien *Alien) {
+    if alien.transit != nil {
+        w.turnBack(alien, alien.transit.length)
     }
 }
 
-// Removes connections to the city, and destroys the city and both aliens.
+// Removes connections to the city, and destroys the city and both aliens. The world remembers the city as a ruin if
+// the simulation rebuilds destroyed cities.
 func (w *WorldX) destroyCity(city *City, alien1 *Alien, alien2 *Alien) {
+    w.destroyedCities++
+    w.recordFall(city)
+    w.recordRuin(city)
     w.deleteAlien(alien1)
     w.deleteAlien(alien2)
     w.deleteCity(city)
@@ -220,9 +670,25 @@ func (w *WorldX) deleteCity(city *City) {
         return
     }
 
-    for dir, connection := range city.connectedCities {
-        if connection != nil {
-            connection.connectedCities[Direction(dir).GetOpposite()] = nil
+    for dir := range city.connectedCities {
+        city.setConnection(Direction(dir), nil, 0)
+    }
+    for connection := range city.incoming {
+        for dir, connectedCity := range connection.connectedCities {
+            if connectedCity == city {
+                connection.setConnection(Direction(dir), nil, 0)
+            }
+        }
+    }
+    for _, portal := range city.portals {
+        portal.removePortal(city)
+    }
+    city.portals = nil
+
+    // Aliens travelling to the city turn back, or are stranded on the road if the city they left is gone too
+    for _, a := range w.allUnits() {
+        if a.transit != nil && a.transit.to == city {
+            w.turnBack(a, a.transit.length-a.transit.remaining)
         }
     }
 
@@ -243,14 +709,34 @@ func (w *WorldX) deleteAlien(alien *Alien) {
         alien.location.alien = nil
         alien.location = nil
     }
-    delete(w.Aliens, alien.name)
+    alien.transit = nil
+    delete(w.units(alien.faction), alien.name)
     alien = nil
 }
 
 type Alien struct {
-    name      string
-    location  *City
-    isTrapped bool
+    name        string
+    location    *City            // City where the alien is, nil while travelling
+    transit     *transit         // Road the alien is travelling, nil while in a city
+    isTrapped   bool
+    isExhausted bool
+    health      int              // Fights the alien survives
+    energy      int              // Energy left to take roads, UnlimitedEnergy if it never runs out
+    initialized bool             // Health and energy were set by a simulation
+    strategy    MovementStrategy // Strategy to choose where the alien moves, nil for the one of the simulation
+    faction     Faction
+    age         int              // Iterations of simulations the alien survived
+}
+
+// Energy of aliens that never run out of it.
+const UnlimitedEnergy int = -1
+
+// Road an alien is travelling between two cities.
+type transit struct {
+    from      *City
+    to        *City
+    length    int
+    remaining int // Iterations left until the alien arrives
 }
 
 func (a *Alien) Name() string {
@@ -265,9 +751,68 @@ func (a *Alien) IsTrapped() bool {
     return a.isTrapped
 }
 
+// Returns the side the alien fights for, InvaderFaction unless it's a defender.
+func (a *Alien) Faction() Faction {
+    return a.faction
+}
+
+// Returns true if the alien has no energy left to take any of the roads leaving its city, it won't move anymore.
+func (a *Alien) IsExhausted() bool {
+    return a.isExhausted
+}
+
+// Returns the number of fights the alien survives.
+func (a *Alien) Health() int {
+    return a.health
+}
+
+// Returns the energy the alien has left to take roads, or UnlimitedEnergy if it never runs out.
+func (a *Alien) Energy() int {
+    return a.energy
+}
+
+// Sets the strategy the alien uses to choose where it moves, nil uses the strategy of the simulation.
+func (a *Alien) SetStrategy(strategy MovementStrategy) {
+    a.strategy = strategy
+}
+
+// Returns true if the alien is on a road between two cities, in which case it has no location.
+func (a *Alien) IsTravelling() bool {
+    return a.transit != nil
+}
+
+// Returns the city the travelling alien left, which may have been destroyed since, or nil if it isn't travelling.
+func (a *Alien) Origin() *City {
+    if a.transit == nil {
+        return nil
+    }
+    return a.transit.from
+}
+
+// Returns the city the travelling alien is heading to, or nil if it isn't travelling.
+func (a *Alien) Destination() *City {
+    if a.transit == nil {
+        return nil
+    }
+    return a.transit.to
+}
+
+// Returns the iterations left until the travelling alien arrives at its destination, 0 if it isn't travelling.
+func (a *Alien) RemainingTravel() int {
+    if a.transit == nil {
+        return 0
+    }
+    return a.transit.remaining
+}
+
 type City struct {
     name            string
-    connectedCities [MaxDirections]*City
+    connectedCities []*City       // Outgoing roads indexed by Direction, only grows as far as the directions connected
+    roadLengths     []int         // Iterations to travel each outgoing road, indexed by Direction
+    incoming        map[*City]int // Number of roads from each city that lead to this city
+    portals         []*City       // Cities connected by portals, sorted by name
+    attributes      map[string]string
+    damage          int // Damage of the fights in the city, destroyed when it reaches its defense
     alien           *Alien
 }
 
@@ -276,93 +821,167 @@ func (c *City) Name() string {
 }
 
 func (c *City) Connection(dir Direction) *City {
+    if dir < 0 || int(dir) >= len(c.connectedCities) {
+        return nil
+    }
     return c.connectedCities[dir]
 }
 
+// Returns the number of iterations aliens take to travel the road leaving the city in the direction, 0 if there's none.
+func (c *City) RoadLength(dir Direction) int {
+    if c.Connection(dir) == nil {
+        return 0
+    }
+    return c.roadLengths[dir]
+}
+
+// Returns true if there's a road from the city in the direction without a road back in the opposite direction.
+func (c *City) IsOneWay(dir Direction) bool {
+    connection := c.Connection(dir)
+    return connection != nil && connection.Connection(dir.GetOpposite()) != c
+}
+
+// Sets the road from the city in the direction, or removes it if city is nil, keeping track of incoming roads.
+func (c *City) setConnection(dir Direction, city *City, length int) {
+    for int(dir) >= len(c.connectedCities) {
+        c.connectedCities = append(c.connectedCities, nil)
+        c.roadLengths = append(c.roadLengths, 0)
+    }
+
+    if previous := c.connectedCities[dir]; previous != nil {
+        if previous.incoming[c]--; previous.incoming[c] <= 0 {
+            delete(previous.incoming, c)
+        }
+    }
+    c.connectedCities[dir], c.roadLengths[dir] = city, length
+    if city != nil {
+        if city.incoming == nil {
+            city.incoming = make(map[*City]int)
+        }
+        city.incoming[c]++
+    }
+}
+
 func (c *City) Alien() *Alien {
     return c.alien
 }
 
-func (c *City) String() (cStr string) {
-    cStr = c.name
-    for dir, connection := range c.connectedCities {
-        if connection != nil {
-            cStr += " " + Direction(dir).String() + "=" + connection.name
-        }
+// Returns the damage of the fights in the city, it's destroyed when the damage reaches its defense.
+func (c *City) Damage() int {
+    return c.damage
+}
+
+// Returns the value of the attribute of the city, e.g. `population`, and whether it's set.
+func (c *City) Attribute(key string) (string, bool) {
+    value, ok := c.attributes[key]
+    return value, ok
+}
+
+// Returns the value of the attribute of the city as an integer, or defaultValue if it isn't set or isn't an integer.
+func (c *City) IntAttribute(key string, defaultValue int) int {
+    if value, err := strconv.Atoi(c.attributes[key]); err == nil {
+        return value
     }
-    return
+    return defaultValue
 }
 
-func (c *City) IsIsolated() bool {
-    for _, connection := range c.connectedCities {
-        if connection != nil {
-            return false
-        }
+// Returns a copy of the attributes of the city.
+func (c *City) Attributes() map[string]string {
+    attributes := make(map[string]string, len(c.attributes))
+    for key, value := range c.attributes {
+        attributes[key] = value
     }
-    return true
+    return attributes
 }
 
-// Returns pointer to random connected city or nil if city is isolated (i.e. doesn't have connections).
-func (c *City) getRandomConnection() (randomCity *City) {
-    if c.IsIsolated() {
-        return nil
+// Sets the attribute of the city.
+// Panics if the key isn't a valid attribute name, made of letters, digits, `-` and `_`, or is a built-in direction.
+// Keys that are aliases or custom directions of the world are read back from its map as roads.
+func (c *City) SetAttribute(key string, value string) {
+    if !isValidAttributeName(key) {
+        log.Panicf("SetAttribute: invalid attribute name %q.", key)
     }
 
-    for {
-        if randomCity = c.connectedCities[rand.Intn(int(MaxDirections))]; randomCity != nil {
-            return
-        }
+    if c.attributes == nil {
+        c.attributes = make(map[string]string)
     }
+    c.attributes[key] = value
 }
 
-type Direction int
+// Removes the attribute from the city.
+func (c *City) DeleteAttribute(key string) {
+    delete(c.attributes, key)
+}
 
-const (
-    North Direction = iota
-    South
-    East
-    West
-    MaxDirections
-    UnknownDirection = -1
-)
+func (c *City) String() string {
+    return c.format(nil, true)
+}
+
+// Returns the line of the city in the world map, only with the roads and portals to the cities included,
+// or all of them if include is nil, and without its region attribute unless withRegion.
+func (c *City) format(include func(*City) bool, withRegion bool) (cStr string) {
+    cStr = formatName(c.name)
+    for dir, connection := range c.connectedCities {
+        if connection == nil || include != nil && !include(connection) {
+            continue
+        }
 
-func GetDirection(dir string) Direction {
-    switch dir {
-    case "north":
-        return North
-    case "south":
-        return South
-    case "east":
-        return East
-    case "west":
-        return West
-    default:
-        return UnknownDirection
+        cStr += " "
+        if c.IsOneWay(Direction(dir)) {
+            cStr += oneWayPrefix
+        }
+        cStr += Direction(dir).String() + directionSeparator + formatRoad(connection.name, c.roadLengths[dir])
+    }
+    for _, portal := range c.portals {
+        if include != nil && !include(portal) {
+            continue
+        }
+        cStr += " " + portalKey + directionSeparator + formatName(portal.name)
     }
+
+    keys := make([]string, 0, len(c.attributes))
+    for key := range c.attributes {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    for _, key := range keys {
+        if key == regionAttribute && !withRegion {
+            continue
+        }
+        cStr += " " + key + directionSeparator + formatName(c.attributes[key])
+    }
+    return
 }
 
-func (d Direction) String() string {
-    if d < 0 || d >= MaxDirections {
-        return "unknown"
+// Returns true if there are no roads or portals leaving the city, roads that only lead to the city aren't considered.
+func (c *City) IsIsolated() bool {
+    for _, connection := range c.connectedCities {
+        if connection != nil {
+            return false
+        }
     }
-    return [...]string{"north", "south", "east", "west"}[d]
+    return len(c.portals) == 0
 }
 
-func (d Direction) IsValid() bool {
-    return d == North || d == South || d == East || d == West
+// Returns the roads leaving the city ordered by direction, followed by its portals.
+func (c *City) Roads() (roads []Road) {
+    for dir, connection := range c.connectedCities {
+        if connection != nil {
+            roads = append(roads, Road{Direction: Direction(dir), Destination: connection, Length: c.roadLengths[dir],
+                Cost: connection.cost()})
+        }
+    }
+    for _, portal := range c.portals {
+        roads = append(roads, Road{Direction: UnknownDirection, Destination: portal, Length: 1, Cost: portal.cost(),
+            Portal: true})
+    }
+    return
 }
 
-func (d Direction) GetOpposite() Direction {
-    switch d {
-    case North:
-        return South
-    case South:
-        return North
-    case East:
-        return West
-    case West:
-        return East
-    default:
-        return UnknownDirection
+// Returns the energy aliens spend to reach the city, from its `cost` attribute.
+func (c *City) cost() int {
+    if cost := c.IntAttribute(costAttribute, 1); cost > 0 {
+        return cost
     }
+    return 0
 }
@@ -1,12 +1,18 @@
-package worldx
+package worldx_test
 
 import (
     "bufio"
     "bytes"
+    "compress/gzip"
+    "errors"
+    "math/rand"
+    "reflect"
+    "runtime/debug"
     "strconv"
     "strings"
     "testing"
 
+    "github.com/klauspost/compress/zstd"
     "github.com/tomasnunes/invasion/pkg/worldx"
 )
 
@@ -42,10 +48,8 @@ Alone
         "Alone": {},
     }
 
-    scannerWithWorldMap := bufio.NewScanner(strings.NewReader(inputWorldMap))
-
     actualWorld := worldx.WorldX{}
-    actualWorld.ReadWorldMap(scannerWithWorldMap)
+    actualWorld.ReadWorldMap(strings.NewReader(inputWorldMap))
 
     if totalActualCities, totalExpectedCities := len(actualWorld.Cities), len(expectedCities);
         totalActualCities != totalExpectedCities {
@@ -71,6 +75,121 @@ Alone
     }
 }
 
+func TestReadWorldMapWithQuotedNamesAndComments(t *testing.T) {
+    const inputWorldMap = `%worldx 1
+# Cities with spaces in their names need to be quoted.
+
+"New York" north="Old \\ \"Town\"" south=Foo  # Trailing comment
+Foo#1 east="#Bar"
+`
+
+    actualWorld := worldx.WorldX{}
+    actualWorld.ReadWorldMap(strings.NewReader(inputWorldMap))
+
+    if totalActualCities := len(actualWorld.Cities); totalActualCities != 5 {
+        t.Errorf("The amount of cities created doesn't equal the expected amount: expected: 5 != actual: %d",
+            totalActualCities)
+    }
+
+    if newYork, ok := actualWorld.Cities["New York"]; !ok {
+        t.Error("Unable to find expected city: New York")
+    } else if oldTown := newYork.Connection(worldx.North); oldTown == nil || oldTown.Name() != `Old \ "Town"` {
+        t.Errorf("Expected connection: New York north=Old \\ \"Town\", actual: %v", oldTown)
+    }
+
+    if bar := actualWorld.Cities["#Bar"]; bar == nil || bar.Connection(worldx.West) != actualWorld.Cities["Foo#1"] {
+        t.Error("Expected connection: #Bar west=Foo#1")
+    }
+
+    // Comments are kept, the header as written
+    expectedString := `%worldx 1
+# Cities with spaces in their names need to be quoted.
+
+"#Bar" west=Foo#1
+Foo north="New York"
+Foo#1 east="#Bar"
+"New York" north="Old \\ \"Town\"" south=Foo # Trailing comment
+"Old \\ \"Town\"" south="New York"
+`
+    if actualString := actualWorld.String(); actualString != expectedString {
+        t.Errorf("Wrong canonical world map: expected:\n%s\nactual:\n%s", expectedString, actualString)
+    }
+}
+
+func TestReadWorldMapWithInvalidLines(t *testing.T) {
+    var invalidWorldMaps = []string{
+        `"New York north=Foo`,
+        `"New York"north=Foo`,
+        "Foo\n%worldx 1",
+        "%worldx 2",
+        "%unknown",
+    }
+
+    for _, inputWorldMap := range invalidWorldMaps {
+        func() {
+            defer func() {
+                if r := recover(); r == nil {
+                    t.Errorf("Expected panic when reading invalid world map: %q", inputWorldMap)
+                }
+            }()
+
+            world := worldx.WorldX{}
+            world.ReadWorldMap(strings.NewReader(inputWorldMap))
+        }()
+    }
+}
+
+func TestReadWorldMapWithLongLines(t *testing.T) {
+    longName := strings.Repeat("X", 2*bufio.MaxScanTokenSize)
+    inputWorldMap := "Foo north=" + longName + "\r\n" + longName + " west=Bar"
+
+    actualWorld := worldx.WorldX{}
+    _, err := actualWorld.ReadWorldMapWithOptions(strings.NewReader(inputWorldMap), worldx.ReadOptions{})
+    if err != nil {
+        t.Fatalf("Unexpected error reading world map with long lines: %v", err)
+    }
+
+    if longCity, ok := actualWorld.Cities[longName]; !ok {
+        t.Error("Unable to find city with long name")
+    } else if longCity.Connection(worldx.South) == nil || longCity.Connection(worldx.West) == nil {
+        t.Errorf("Wrong connections of city with long name: %s", longCity.String()[len(longName):])
+    }
+
+    options := worldx.ReadOptions{MaxLineLength: len(longName)}
+    _, err = (&worldx.WorldX{}).ReadWorldMapWithOptions(strings.NewReader(inputWorldMap), options)
+    if !errors.Is(err, worldx.ErrLineTooLong) {
+        t.Errorf("Expected error %v when line exceeds the maximum length, actual: %v", worldx.ErrLineTooLong, err)
+    }
+}
+
+func TestReadWorldMapCompressed(t *testing.T) {
+    const inputWorldMap = "Foo north=Bar\nBaz west=Foo\n"
+
+    var gzipped bytes.Buffer
+    gzipWriter := gzip.NewWriter(&gzipped)
+    if _, err := gzipWriter.Write([]byte(inputWorldMap)); err != nil {
+        t.Fatal(err)
+    } else if err := gzipWriter.Close(); err != nil {
+        t.Fatal(err)
+    }
+
+    zstdEncoder, err := zstd.NewWriter(nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    zstdCompressed := zstdEncoder.EncodeAll([]byte(inputWorldMap), nil)
+
+    for format, compressed := range map[string][]byte{"gzip": gzipped.Bytes(), "zstd": zstdCompressed} {
+        actualWorld := worldx.WorldX{}
+        actualWorld.ReadWorldMap(bytes.NewReader(compressed))
+
+        expectedString := "Bar south=Foo\nBaz west=Foo\nFoo north=Bar east=Baz\n"
+        if actualString := actualWorld.String(); actualString != expectedString {
+            t.Errorf("Wrong world map read from %s compressed input:\n%s", format, actualString)
+        }
+    }
+}
+
 func getGenerateAliensTestWorld(numberCities int) (testWorld worldx.WorldX) {
     for i := 0; i < numberCities; i++ {
         cityName := strconv.Itoa(i)
@@ -184,6 +303,8 @@ func TestRunSimulationWhenAliensFight(t *testing.T) {
 
     if len(testWorld.Cities) != 1 || len(testWorld.Aliens) != 0 {
         t.Error("When aliens meet and fight one city should be destroyed and both aliens die")
+    } else if len(testWorld.Ruins()) != 0 {
+        t.Errorf("Destroyed cities shouldn't be remembered when they aren't rebuilt: %v", testWorld.Ruins())
     }
 
     var remainingCity *worldx.City
@@ -215,8 +336,11 @@ func TestDirection(t *testing.T) {
         {worldx.South,            true , "south",   worldx.North},
         {worldx.East,             true , "east",    worldx.West},
         {worldx.West,             true , "west",    worldx.East},
+        {worldx.NorthEast,        true,  "northeast", worldx.SouthWest},
+        {worldx.Up,               true,  "up",      worldx.Down},
         {worldx.UnknownDirection, false, "unknown", worldx.UnknownDirection},
         {worldx.MaxDirections,    false, "unknown", worldx.UnknownDirection},
+        {worldx.Direction(1 << 20), false, "unknown", worldx.UnknownDirection},
         {worldx.Direction(-10),   false, "unknown", worldx.UnknownDirection},
     }
 
@@ -237,3 +361,1188 @@ func TestDirection(t *testing.T) {
         }
     }
 }
+
+func TestDeclareDirection(t *testing.T) {
+    world := worldx.WorldX{}
+    inward, err := world.DeclareDirection("inward", "outward", "in")
+    if err != nil {
+        t.Fatalf("Unexpected error declaring direction: %v", err)
+    }
+
+    outward := world.GetDirection("outward")
+    if !inward.IsValid() || !outward.IsValid() || inward <= worldx.MaxDirections || outward <= worldx.MaxDirections {
+        t.Errorf("Custom directions should be valid and follow the built-in directions: %d %d", inward, outward)
+    } else if inward.GetOpposite() != outward || outward.GetOpposite() != inward {
+        t.Errorf("Custom directions should be opposite: %v.GetOpposite() = %v", inward, inward.GetOpposite())
+    } else if world.GetDirection("IN") != inward {
+        t.Error("Alias of custom direction should resolve to the direction ignoring case")
+    } else if !world.HasDirection(inward) || !world.HasDirection(outward) || !world.HasDirection(worldx.North) {
+        t.Errorf("Declared directions should be added to the directions of the world: %v", world.Directions())
+    }
+
+    if dir, err := world.DeclareDirection("inward", "outward"); err != nil || dir != inward {
+        t.Errorf("Declaring the same direction again should return it: %v %v", dir, err)
+    }
+    if _, err := world.DeclareDirection("inward", "north"); err == nil {
+        t.Error("Expected error when declaring a direction with a different opposite")
+    }
+    if _, err := world.DeclareDirection("sideways", "backways", "in"); err == nil {
+        t.Error("Expected error when declaring an alias of another direction")
+    }
+    if _, err := world.DeclareDirection("in side", "out side"); err == nil {
+        t.Error("Expected error when declaring a direction with an invalid name")
+    }
+
+    // Custom directions are only known by the worlds that declare them, which can give them other opposites
+    if worldx.GetDirection("inward").IsValid() || (&worldx.WorldX{}).GetDirection("inward").IsValid() {
+        t.Error("Custom directions shouldn't be known outside the world that declares them")
+    }
+    other := worldx.WorldX{}
+    otherInward, err := other.DeclareDirection("inward", "sideways")
+    if err != nil || otherInward == inward || otherInward.String() != "inward" ||
+        otherInward.GetOpposite() != other.GetDirection("sideways") {
+        t.Errorf("Another world should declare inward with another opposite: %v %v", otherInward, err)
+    } else if world.GetDirection("inward") != inward {
+        t.Error("Declaring a direction in another world shouldn't change this world")
+    }
+    if errs := world.Merge(&other); len(errs) != 1 {
+        t.Errorf("Expected an error merging a direction with another opposite: %v", errs)
+    }
+
+    if spin, err := world.DeclareDirection("spin", "spin"); err != nil || spin.GetOpposite() != spin {
+        t.Errorf("A direction should be its own opposite when declared so: %v %v", spin, err)
+    }
+}
+
+func TestAddConnectionInDirectionsOfTheWorld(t *testing.T) {
+    world := worldx.WorldX{}
+    a, b := world.CreateCity("A"), world.CreateCity("B")
+    for _, addRoad := range []func(){
+        func() { world.AddConnection(a, b, worldx.NorthEast) },
+        func() { world.AddOneWayConnection(a, b, worldx.Up) },
+    } {
+        func() {
+            defer func() {
+                if r := recover(); r == nil {
+                    t.Error("Expected panic when adding a road in a direction the world doesn't have")
+                }
+            }()
+            addRoad()
+        }()
+    }
+
+    // Roads in the directions of the world are read back
+    world.SetDirections(worldx.North, worldx.South, worldx.NorthEast, worldx.SouthWest)
+    world.AddConnection(a, b, worldx.NorthEast)
+    readBackWorld := worldx.WorldX{}
+    readBackWorld.ReadWorldMap(strings.NewReader(world.String()))
+    if actualString, readBackString := world.String(), readBackWorld.String(); actualString != readBackString {
+        t.Errorf("World map changed when read back: expected:\n%s\nactual:\n%s", actualString, readBackString)
+    } else if errs := world.Validate(); len(errs) > 0 {
+        t.Errorf("World should be valid: %v", errs)
+    }
+
+    // Roads back in directions the map doesn't declare are ignored
+    oneWayWorld := worldx.WorldX{}
+    diagnostics, err := oneWayWorld.ReadWorldMapWithOptions(strings.NewReader("%directions north\nA north=B\n"),
+        worldx.ReadOptions{})
+    if err != nil || len(diagnostics) != 1 || !diagnostics[0].Unfixable ||
+        !oneWayWorld.Cities["A"].IsOneWay(worldx.North) {
+        t.Errorf("Expected a one-way road and a diagnostic for the road back: %v %v", diagnostics, err)
+    }
+
+    // Roads left in directions the world no longer has aren't valid
+    world.SetDirections(worldx.North, worldx.South)
+    if errs := world.Validate(); len(errs) != 2 {
+        t.Errorf("Expected an error for each road in a direction the world doesn't have: %v", errs)
+    }
+}
+
+func TestReadWorldMapWithDirections(t *testing.T) {
+    const inputWorldMap = `%worldx 1
+%direction clockwise counterclockwise
+%directions hex vertical clockwise counterclockwise
+Foo northeast=Bar up=Baz north=Ignored clockwise=Baz
+`
+
+    actualWorld := worldx.WorldX{}
+    actualWorld.ReadWorldMap(strings.NewReader(inputWorldMap))
+
+    foo := actualWorld.Cities["Foo"]
+    if foo == nil || foo.Connection(worldx.NorthEast) == nil || foo.Connection(worldx.Up) == nil {
+        t.Fatal("Expected connections: Foo northeast=Bar up=Baz")
+    } else if foo.Connection(worldx.North) != nil || actualWorld.Cities["Ignored"] != nil {
+        t.Error("Connections in directions the world doesn't have should be ignored")
+    } else if baz := actualWorld.Cities["Baz"]; baz.Connection(actualWorld.GetDirection("counterclockwise")) != foo {
+        t.Error("Expected connection: Baz counterclockwise=Foo")
+    }
+
+    // The canonical world map should be read back into the same world
+    readBackWorld := worldx.WorldX{}
+    readBackWorld.ReadWorldMap(strings.NewReader(actualWorld.String()))
+    if actualString, readBackString := actualWorld.String(), readBackWorld.String(); actualString != readBackString {
+        t.Errorf("World map changed when read back: expected:\n%s\nactual:\n%s", actualString, readBackString)
+    }
+
+    // Other maps can declare the same direction with another opposite
+    otherWorld := worldx.WorldX{}
+    otherWorld.ReadWorldMap(strings.NewReader("%direction clockwise anticlockwise\nFoo clockwise=Bar\n"))
+    if clockwise := otherWorld.GetDirection("clockwise"); clockwise.GetOpposite().String() != "anticlockwise" {
+        t.Errorf("Expected clockwise opposite to anticlockwise, actual %v", clockwise.GetOpposite())
+    } else if actualWorld.GetDirection("clockwise").GetOpposite().String() != "counterclockwise" {
+        t.Error("Reading another map shouldn't change the directions of the world")
+    }
+}
+
+func TestReadWorldMapWithDirectionAliases(t *testing.T) {
+    const inputWorldMap = `Foo N=Bar East=Baz w=Qux south=Quux
+Bar Left=Corge
+`
+
+    actualWorld := worldx.WorldX{}
+    options := worldx.ReadOptions{Aliases: map[string]worldx.Direction{"left": worldx.West}}
+    diagnostics, err := actualWorld.ReadWorldMapWithOptions(strings.NewReader(inputWorldMap), options)
+    if err != nil {
+        t.Fatalf("Unexpected error reading world map with direction aliases: %v", err)
+    }
+
+    expectedString := `Bar south=Foo west=Corge
+Baz west=Foo
+Corge east=Bar
+Foo north=Bar south=Quux east=Baz west=Qux
+Quux north=Foo
+Qux east=Foo
+`
+    if actualString := actualWorld.String(); actualString != expectedString {
+        t.Errorf("Wrong canonical world map: expected:\n%s\nactual:\n%s", expectedString, actualString)
+    }
+
+    expectedDiagnostics := []worldx.Diagnostic{
+        {Line: 1, Message: `direction "N" read as "north"`},
+        {Line: 1, Message: `direction "East" read as "east"`},
+        {Line: 1, Message: `direction "w" read as "west"`},
+        {Line: 2, Message: `direction "Left" read as "west"`},
+    }
+    if len(diagnostics) != len(expectedDiagnostics) {
+        t.Fatalf("Wrong diagnostics: expected: %v != actual: %v", expectedDiagnostics, diagnostics)
+    }
+    for i := range expectedDiagnostics {
+        if diagnostics[i] != expectedDiagnostics[i] {
+            t.Errorf("Wrong diagnostic: expected: %v != actual: %v", expectedDiagnostics[i], diagnostics[i])
+        }
+    }
+
+    // Aliases of directions the map doesn't have are attributes
+    attributesWorld := worldx.WorldX{}
+    attributesWorld.ReadWorldMap(strings.NewReader("Foo d=4 ne=x e=Bar\n"))
+    if foo := attributesWorld.Cities["Foo"]; foo.IntAttribute("d", 0) != 4 || foo.Connection(worldx.East) == nil {
+        t.Errorf("Expected attribute d=4 and connection east=Bar, actual: %v", foo)
+    } else if value, ok := foo.Attribute("ne"); !ok || value != "x" {
+        t.Errorf("Expected attribute ne=x, actual: %v", foo)
+    }
+
+    verticalWorld := worldx.WorldX{}
+    verticalWorld.ReadWorldMap(strings.NewReader("%directions vertical\nFoo d=Bar\n"))
+    if foo := verticalWorld.Cities["Foo"]; foo.Connection(worldx.Down) == nil {
+        t.Errorf("Expected connection down=Bar in a map with vertical directions, actual: %v", foo)
+    }
+}
+
+func TestOneWayConnections(t *testing.T) {
+    const inputWorldMap = `Ramp >north=Top south=Bottom
+Plateau >west=Top
+`
+
+    testWorld := worldx.WorldX{}
+    testWorld.ReadWorldMap(strings.NewReader(inputWorldMap))
+
+    ramp, top := testWorld.Cities["Ramp"], testWorld.Cities["Top"]
+    if ramp.Connection(worldx.North) != top || top.Connection(worldx.South) != nil || !ramp.IsOneWay(worldx.North) {
+        t.Error("Expected one-way connection: Ramp >north=Top")
+    } else if !top.IsIsolated() {
+        t.Error("City with only incoming roads should be isolated")
+    }
+
+    expectedString := `Bottom north=Ramp
+Plateau >west=Top
+Ramp >north=Top south=Bottom
+Top
+`
+    if actualString := testWorld.String(); actualString != expectedString {
+        t.Errorf("Wrong canonical world map: expected:\n%s\nactual:\n%s", expectedString, actualString)
+    }
+
+    // The alien in Top can't leave, the alien in Plateau can only move to Top
+    if trappedAlien := testWorld.CreateAlien("0", []string{"Top"}); !trappedAlien.IsTrapped() {
+        t.Error("Alien in a city with only incoming roads should be trapped")
+    }
+    testWorld.CreateAlien("1", []string{"Plateau"})
+
+    buf := new(bytes.Buffer)
+    testWorld.RunSimulation(bufio.NewWriter(buf))
+
+    if destroyMessage := buf.String(); destroyMessage != "Top has been destroyed by alien 1 and alien 0\n" {
+        t.Errorf("Wrong message when destroying city: %s", destroyMessage)
+    } else if ramp.Connection(worldx.North) != nil || !testWorld.Cities["Plateau"].IsIsolated() {
+        t.Errorf("One-way roads to a destroyed city should be severed:\n%s", testWorld.String())
+    }
+}
+
+func TestWeightedRoads(t *testing.T) {
+    const inputWorldMap = `Foo north=Bar:3 south="Baz:2" east="Qux":2
+`
+
+    testWorld := worldx.WorldX{}
+    testWorld.ReadWorldMap(strings.NewReader(inputWorldMap))
+
+    foo := testWorld.Cities["Foo"]
+    if foo.RoadLength(worldx.North) != 3 || testWorld.Cities["Bar"].RoadLength(worldx.South) != 3 {
+        t.Errorf("Expected road of length 3 in both directions: Foo north=Bar:3")
+    } else if foo.Connection(worldx.South).Name() != "Baz:2" || foo.RoadLength(worldx.South) != 1 {
+        t.Errorf("Quoted names should never contain a road length: Foo south=\"Baz:2\"")
+    } else if foo.Connection(worldx.East).Name() != "Qux" || foo.RoadLength(worldx.East) != 2 {
+        t.Errorf("Expected road of length 2 to quoted name: Foo east=\"Qux\":2")
+    }
+
+    expectedString := `Bar south=Foo:3
+"Baz:2" north=Foo
+Foo north=Bar:3 south="Baz:2" east=Qux:2
+Qux west=Foo:2
+`
+    if actualString := testWorld.String(); actualString != expectedString {
+        t.Errorf("Wrong canonical world map: expected:\n%s\nactual:\n%s", expectedString, actualString)
+    }
+
+    invalidWorldMap := strings.NewReader(`Foo north="Bar":0`)
+    if _, err := (&worldx.WorldX{}).ReadWorldMapWithOptions(invalidWorldMap, worldx.ReadOptions{}); err == nil {
+        t.Error("Expected error when reading road with invalid length")
+    }
+}
+
+func TestRunSimulationWithTravellingAliens(t *testing.T) {
+    testWorld := getRunSimulationTestWorld(2, 1)
+    testWorld.AddConnection(testWorld.Cities["0"], testWorld.Cities["1"], worldx.North)
+    testWorld.SetRoadLength(testWorld.Cities["0"], worldx.North, 3)
+
+    var events []worldx.Event
+    options := worldx.SimulationOptions{MaxIterations: 2, OnEvent: func(e worldx.Event) { events = append(events, e) }}
+
+    buf := new(bytes.Buffer)
+    testWorld.RunSimulationWithOptions(bufio.NewWriter(buf), options)
+
+    alien := testWorld.Aliens["0"]
+    if !alien.IsTravelling() || alien.Location() != nil || alien.RemainingTravel() != 1 {
+        t.Errorf("Alien should still be travelling after 2 iterations on a road of length 3")
+    } else if len(events) != 1 || events[0].Type != worldx.AlienDeparted || events[0].Length != 3 {
+        t.Errorf("Expected a single departure event, actual: %v", events)
+    } else if alien.Origin().Alien() != nil {
+        t.Error("Alien should leave its city when it starts travelling")
+    }
+
+    options.MaxIterations = 1
+    testWorld.RunSimulationWithOptions(bufio.NewWriter(buf), options)
+
+    if alien.IsTravelling() || alien.Location() == nil || alien.Location().Alien() != alien {
+        t.Error("Alien should arrive at its destination after travelling for the length of the road")
+    }
+}
+
+func TestRunSimulationWithHeadOnCollisions(t *testing.T) {
+    testWorld := getRunSimulationTestWorld(2, 2)
+    testWorld.AddConnection(testWorld.Cities["0"], testWorld.Cities["1"], worldx.North)
+    testWorld.SetRoadLength(testWorld.Cities["0"], worldx.North, 3)
+
+    buf := new(bytes.Buffer)
+    testWorld.RunSimulationWithOptions(bufio.NewWriter(buf), worldx.SimulationOptions{HeadOnCollisions: true})
+
+    if len(testWorld.Aliens) != 0 || len(testWorld.Cities) != 2 {
+        t.Errorf("Aliens meeting head-on should destroy each other without destroying any city")
+    } else if !strings.Contains(buf.String(), "destroyed each other on the road between") {
+        t.Errorf("Wrong messages when aliens collide on the road:\n%s", buf.String())
+    }
+}
+
+func TestRunSimulationWithHeadOnCollisionsBetweenSeveralAliens(t *testing.T) {
+    testWorld := worldx.WorldX{}
+    a, b, c := testWorld.CreateCity("A"), testWorld.CreateCity("B"), testWorld.CreateCity("C")
+    testWorld.AddConnection(a, b, worldx.North)
+    testWorld.SetRoadLength(a, worldx.North, 5)
+    testWorld.AddOneWayConnection(c, b, worldx.East)
+
+    // Moves the alien after staying in its city the given number of iterations
+    moveAfter := func(iterations int) worldx.MovementStrategy {
+        return worldx.MovementStrategyFunc(func(_ *worldx.Alien, _ []worldx.Road, _ *rand.Rand) int {
+            if iterations--; iterations >= 0 {
+                return -1
+            }
+            return 0
+        })
+    }
+
+    // x and then y leave B towards A, and z leaves A towards B when x is one iteration away and y three
+    testWorld.CreateAlien("x", []string{"B"}).SetStrategy(moveAfter(0))
+    testWorld.CreateAlien("y", []string{"C"}).SetStrategy(moveAfter(1))
+    testWorld.CreateAlien("z", []string{"A"}).SetStrategy(moveAfter(3))
+
+    buf := new(bytes.Buffer)
+    options := worldx.SimulationOptions{MaxIterations: 4, HeadOnCollisions: true}
+    testWorld.RunSimulationWithOptions(bufio.NewWriter(buf), options)
+
+    if _, ok := testWorld.Aliens["y"]; !ok || len(testWorld.Aliens) != 1 {
+        t.Errorf("z should collide with x, the closest alien coming the other way, actual aliens left: %v\n%s",
+            testWorld.Aliens, buf.String())
+    } else if !testWorld.Aliens["y"].IsTravelling() || testWorld.Aliens["y"].RemainingTravel() != 3 {
+        t.Errorf("y should keep travelling towards A after the collision:\n%s", buf.String())
+    }
+}
+
+func TestCityAttributes(t *testing.T) {
+    const inputWorldMap = `Foo population=1000 north=Bar region="Northern Hills" defense=x:3
+Foo population=5 Stray
+`
+
+    testWorld := worldx.WorldX{}
+    diagnostics, err := testWorld.ReadWorldMapWithOptions(strings.NewReader(inputWorldMap), worldx.ReadOptions{})
+    if err != nil {
+        t.Fatalf("Unexpected error reading world map with attributes: %v", err)
+    } else if len(diagnostics) != 2 {
+        t.Errorf("Expected diagnostics for the repeated attribute and the stray field, actual: %v", diagnostics)
+    }
+
+    foo := testWorld.Cities["Foo"]
+    if region, ok := foo.Attribute("region"); !ok || region != "Northern Hills" {
+        t.Errorf("Wrong attribute: expected region=Northern Hills, actual: region=%s", region)
+    } else if population := foo.IntAttribute("population", 0); population != 1000 {
+        t.Errorf("Wrong attribute: expected population=1000, actual: population=%d", population)
+    } else if defense := foo.IntAttribute("defense", -1); defense != -1 {
+        t.Errorf("Attributes that aren't integers should return the default value, actual: %d", defense)
+    } else if foo.Connection(worldx.North) == nil {
+        t.Error("Expected connection: Foo north=Bar")
+    }
+
+    foo.SetAttribute("capital", "")
+    expectedString := `Bar south=Foo
+Foo north=Bar capital="" defense="x:3" population=1000 region="Northern Hills"
+`
+    if actualString := testWorld.String(); actualString != expectedString {
+        t.Errorf("Wrong canonical world map: expected:\n%s\nactual:\n%s", expectedString, actualString)
+    }
+}
+
+func TestRunSimulationWithCityDefense(t *testing.T) {
+    const inputWorldMap = `Fort defense=2
+A >east=Fort
+B >west=Fort
+C >north=Fort
+D >south=Fort
+`
+
+    testWorld := worldx.WorldX{}
+    testWorld.ReadWorldMap(strings.NewReader(inputWorldMap))
+    for i, city := range []string{"A", "B", "C", "D"} {
+        testWorld.CreateAlien(strconv.Itoa(i), []string{city})
+    }
+
+    var events []worldx.Event
+    options := worldx.SimulationOptions{OnEvent: func(e worldx.Event) { events = append(events, e) }}
+
+    buf := new(bytes.Buffer)
+    testWorld.RunSimulationWithOptions(bufio.NewWriter(buf), options)
+
+    if len(events) != 2 || events[0].Type != worldx.CityDamaged || events[1].Type != worldx.CityDestroyed {
+        t.Fatalf("Fort with defense 2 should be damaged by the first fight and destroyed by the second:\n%s", buf)
+    } else if events[0].Damage != 1 || events[0].Defense != 1 || events[1].Damage != 2 {
+        t.Errorf("Wrong damage recorded: %+v", events)
+    } else if _, ok := testWorld.Cities["Fort"]; ok || len(testWorld.Aliens) != 0 || len(testWorld.Cities) != 4 {
+        t.Errorf("Fort and the four aliens should be destroyed:\n%s", testWorld.String())
+    }
+}
+
+func TestRunSimulationWithAlienEnergy(t *testing.T) {
+    const inputWorldMap = `A east=B
+B east=C
+C east=D
+D cost=3
+`
+
+    testWorld := worldx.WorldX{}
+    testWorld.ReadWorldMap(strings.NewReader(inputWorldMap))
+    alien := testWorld.CreateAlien("0", []string{"A"})
+
+    eastwards := worldx.MovementStrategyFunc(func(alien *worldx.Alien, roads []worldx.Road, _ *rand.Rand) int {
+        for i, road := range roads {
+            if road.Direction == worldx.East {
+                return i
+            }
+        }
+        return -1
+    })
+    options := worldx.SimulationOptions{MaxIterations: 10, AlienEnergy: 4, Strategy: eastwards}
+
+    buf := new(bytes.Buffer)
+    testWorld.RunSimulationWithOptions(bufio.NewWriter(buf), options)
+
+    // Reaching C costs 2, leaving 2 energy that isn't enough for D and only allows going back west to B
+    if alien.Location() != testWorld.Cities["C"] || alien.Energy() != 2 || alien.IsExhausted() || alien.IsTrapped() {
+        t.Fatalf("Alien should stay in C with 2 energy left, it's in %v with %d energy", alien.Location(),
+            alien.Energy())
+    }
+
+    testWorld.Cities["B"].SetAttribute("cost", "3")
+    testWorld.RunSimulationWithOptions(bufio.NewWriter(buf), worldx.SimulationOptions{MaxIterations: 1})
+    if alien.Location() != testWorld.Cities["C"] || !alien.IsExhausted() || alien.IsTrapped() {
+        t.Errorf("Alien without energy for any road should be exhausted, not trapped")
+    } else if summary := testWorld.Summary(); summary.ExhaustedAliens != 1 || summary.TrappedAliens != 0 {
+        t.Errorf("Summary should report one exhausted alien: %s", summary)
+    }
+}
+
+func TestRunSimulationWithAlienHealth(t *testing.T) {
+    const inputWorldMap = `Fort defense=5
+A >east=Fort
+B >west=Fort
+`
+
+    testWorld := worldx.WorldX{}
+    testWorld.ReadWorldMap(strings.NewReader(inputWorldMap))
+    attacker := testWorld.CreateAlien("0", []string{"A"})
+    defender := testWorld.CreateAlien("1", []string{"B"})
+    testWorld.Cities["B"].SetAttribute("cost", "0")
+
+    var events []worldx.Event
+    options := worldx.SimulationOptions{AlienHealth: 2, OnEvent: func(e worldx.Event) { events = append(events, e) }}
+
+    // The defender moves into Fort first, so the attacker is repelled and attacks again the next iteration
+    testWorld.RunSimulationWithOptions(bufio.NewWriter(new(bytes.Buffer)), worldx.SimulationOptions{
+        MaxIterations: 1, AlienHealth: 2, Strategy: worldx.MovementStrategyFunc(
+            func(alien *worldx.Alien, roads []worldx.Road, _ *rand.Rand) int {
+                if alien == defender {
+                    return 0
+                }
+                return -1
+            })})
+    if defender.Location() != testWorld.Cities["Fort"] || defender.Health() != 2 || attacker.Health() != 2 {
+        t.Fatalf("Defender should be in Fort with full health")
+    }
+
+    testWorld.RunSimulationWithOptions(bufio.NewWriter(new(bytes.Buffer)), options)
+    if len(events) != 2 || events[0].Type != worldx.CityDamaged || events[1].Type != worldx.CityDamaged {
+        t.Fatalf("Aliens with health 2 should fight twice before dying: %+v", events)
+    } else if len(testWorld.Aliens) != 0 || testWorld.Cities["Fort"].Damage() != 2 {
+        t.Errorf("Both aliens should be dead and Fort damaged twice:\n%s", testWorld.String())
+    }
+}
+
+func TestRunSimulationWithRebuild(t *testing.T) {
+    const inputWorldMap = `B population=10
+A east=B:2
+C west=B
+D >south=B
+`
+
+    testWorld := worldx.WorldX{}
+    testWorld.ReadWorldMap(strings.NewReader(inputWorldMap))
+    testWorld.CreateAlien("0", []string{"A"})
+    testWorld.CreateAlien("1", []string{"C"})
+
+    towardsB := worldx.MovementStrategyFunc(func(alien *worldx.Alien, roads []worldx.Road, _ *rand.Rand) int {
+        for i, road := range roads {
+            if road.Destination.Name() == "B" {
+                return i
+            }
+        }
+        return -1
+    })
+
+    var events []worldx.Event
+    options := worldx.SimulationOptions{MaxIterations: 4, RebuildAfter: 2, Strategy: towardsB,
+        OnEvent: func(e worldx.Event) { events = append(events, e) }}
+
+    buf := new(bytes.Buffer)
+    testWorld.RunSimulationWithOptions(bufio.NewWriter(buf), options)
+
+    // Alien 0 arrives in B through the long road in the second iteration and alien 1 is already there
+    if len(events) != 3 || events[1].Type != worldx.CityDestroyed || events[2].Type != worldx.CityRebuilt {
+        t.Fatalf("B should be destroyed and rebuilt:\n%s", buf)
+    } else if events[1].Iteration != 1 || events[2].Iteration != 3 {
+        t.Errorf("B should be rebuilt 2 iterations after being destroyed: %+v", events)
+    }
+
+    const expectedWorldMap = `A east=B:2
+B east=C west=A:2 population=10
+C west=B
+D >south=B
+`
+    if testWorld.String() != expectedWorldMap || len(testWorld.Ruins()) != 0 {
+        t.Errorf("B should be rebuilt with its roads and attributes:\n%s", testWorld.String())
+    } else if summary := testWorld.Summary(); summary.DestroyedCities != 1 || summary.RebuiltCities != 1 {
+        t.Errorf("Summary should count the destroyed and rebuilt city: %s", summary)
+    }
+}
+
+func TestRunSimulationRebuildsNeighboursDestroyedTogether(t *testing.T) {
+    testWorld := worldx.WorldX{}
+    testWorld.ReadWorldMap(strings.NewReader("A east=B\nB east=C\nC east=D\nE north=C\n"))
+    for i, name := range []string{"A", "C", "D", "E"} {
+        testWorld.CreateAlien(strconv.Itoa(i), []string{name})
+    }
+
+    // Aliens 0 and 1 destroy B, then aliens 2 and 3 destroy C
+    towardsBOrC := worldx.MovementStrategyFunc(func(alien *worldx.Alien, roads []worldx.Road, _ *rand.Rand) int {
+        for _, name := range []string{"B", "C"} {
+            for i, road := range roads {
+                if road.Destination.Name() == name {
+                    return i
+                }
+            }
+        }
+        return -1
+    })
+
+    var events []worldx.Event
+    options := worldx.SimulationOptions{MaxIterations: 4, RebuildAfter: 2, Strategy: towardsBOrC,
+        OnEvent: func(e worldx.Event) { events = append(events, e) }}
+    testWorld.RunSimulationWithOptions(bufio.NewWriter(new(bytes.Buffer)), options)
+
+    if summary := testWorld.Summary(); summary.DestroyedCities != 2 || summary.RebuiltCities != 2 {
+        t.Fatalf("B and C should be destroyed and rebuilt: %+v", events)
+    }
+    const expectedWorldMap = "A east=B\nB east=C west=A\nC south=E east=D west=B\nD west=C\nE north=C\n"
+    if testWorld.String() != expectedWorldMap {
+        t.Errorf("The road between B and C should be rebuilt too:\n%s", testWorld.String())
+    }
+}
+
+// Returns a world with a square grid of cities and an alien in every other city of the first rows.
+func getGridTestWorld(size int, numberAliens int) (testWorld worldx.WorldX) {
+    for i := 0; i < size*size; i++ {
+        city := testWorld.CreateCity(strconv.Itoa(i))
+        if i%size > 0 {
+            testWorld.AddConnection(city, testWorld.Cities[strconv.Itoa(i-1)], worldx.West)
+        }
+        if i >= size {
+            testWorld.AddConnection(city, testWorld.Cities[strconv.Itoa(i-size)], worldx.North)
+        }
+    }
+
+    for i := 0; i < numberAliens; i++ {
+        testWorld.CreateAlien(strconv.Itoa(i), []string{strconv.Itoa(2 * i)})
+    }
+    return
+}
+
+func TestRunSimulationWithSeed(t *testing.T) {
+    options := worldx.SimulationOptions{MaxIterations: 100, BridgeCollapseChance: 0.2, QuarantineChance: 0.05,
+        Seed: 42}
+
+    var outputs [2]string
+    for i := range outputs {
+        testWorld := getGridTestWorld(6, 8)
+        buf := new(bytes.Buffer)
+        testWorld.RunSimulationWithOptions(bufio.NewWriter(buf), options)
+        outputs[i] = buf.String() + testWorld.String()
+    }
+
+    if outputs[0] != outputs[1] {
+        t.Errorf("Simulations with the same seed should have the same result:\n%s\n!=\n%s", outputs[0], outputs[1])
+    }
+}
+
+func TestRunSimulationWithDisasters(t *testing.T) {
+    testCases := []struct {
+        name    string
+        options worldx.SimulationOptions
+        event   worldx.EventType
+    }{
+        {"bridge collapse", worldx.SimulationOptions{MaxIterations: 1, BridgeCollapseChance: 1}, worldx.BridgeCollapsed},
+        {"quarantine", worldx.SimulationOptions{MaxIterations: 1, QuarantineChance: 1}, worldx.CityQuarantined},
+    }
+
+    for _, tc := range testCases {
+        testWorld := worldx.WorldX{}
+        testWorld.ReadWorldMap(strings.NewReader("A east=B\nB\n"))
+        alien := testWorld.CreateAlien("0", []string{"A"})
+
+        var events []worldx.Event
+        tc.options.OnEvent = func(e worldx.Event) { events = append(events, e) }
+        testWorld.RunSimulationWithOptions(bufio.NewWriter(new(bytes.Buffer)), tc.options)
+
+        if len(events) != 1 || events[0].Type != tc.event {
+            t.Errorf("%s: expected a single %v event, got %+v", tc.name, tc.event, events)
+        } else if testWorld.String() != "A\nB\n" {
+            t.Errorf("%s: the only road should be cut:\n%s", tc.name, testWorld.String())
+        } else if alien.Location() != testWorld.Cities["A"] || !alien.IsTrapped() {
+            t.Errorf("%s: alien should be trapped in A when it loses its last road", tc.name)
+        }
+    }
+}
+
+func TestRunSimulationWithDefenders(t *testing.T) {
+    stay := worldx.MovementStrategyFunc(func(*worldx.Alien, []worldx.Road, *rand.Rand) int { return -1 })
+
+    testCases := []struct {
+        outcome   worldx.DefenseOutcome
+        aliens    int
+        defenders int
+        message   string
+    }{
+        {worldx.InvaderKilled, 0, 1, "alien 0 has been killed by defender d in A"},
+        {worldx.BothKilled, 0, 0, "alien 0 and defender d killed each other in A"},
+        {worldx.DefenderKilled, 1, 0, "defender d has been killed by alien 0 in A"},
+    }
+
+    for _, tc := range testCases {
+        testWorld := worldx.WorldX{}
+        testWorld.ReadWorldMap(strings.NewReader("A east=B\nB east=C\nC\n"))
+        testWorld.CreateAlien("0", []string{"A"})
+        defender := testWorld.CreateDefender("d", []string{"C"})
+
+        buf := new(bytes.Buffer)
+        options := worldx.SimulationOptions{MaxIterations: 2, Strategy: stay, DefenseOutcome: tc.outcome}
+        testWorld.RunSimulationWithOptions(bufio.NewWriter(buf), options)
+
+        // The defender can only go to B first, and then hunts the alien in A instead of going back to C
+        summary := testWorld.Summary()
+        if buf.String() != tc.message+"\n" {
+            t.Errorf("Wrong events, expected: %q != actual: %q", tc.message+"\n", buf.String())
+        } else if summary.Aliens != tc.aliens || summary.Defenders != tc.defenders {
+            t.Errorf("%s: wrong survivors: %s", tc.message, summary)
+        } else if len(testWorld.Cities) != 3 || summary.SavedCities != 1 || summary.DestroyedCities != 0 {
+            t.Errorf("%s: A should be saved: %s", tc.message, summary)
+        } else if tc.defenders == 1 && defender.Location() != testWorld.Cities["A"] {
+            t.Errorf("%s: surviving defender should take the place of the alien", tc.message)
+        }
+    }
+}
+
+func TestRunSimulationWithSpawningAliens(t *testing.T) {
+    testWorld := worldx.WorldX{}
+    testWorld.ReadWorldMap(strings.NewReader("A east=B\nB east=C\nC east=D\nD\n"))
+    testWorld.CreateAlien("0", []string{"A"})
+    testWorld.Aliens["0"].SetStrategy(
+        worldx.MovementStrategyFunc(func(*worldx.Alien, []worldx.Road, *rand.Rand) int { return -1 }))
+
+    buf := new(bytes.Buffer)
+    options := worldx.SimulationOptions{MaxIterations: 10, SpawnEvery: 2, PopulationCap: 3}
+    testWorld.RunSimulationWithOptions(bufio.NewWriter(buf), options)
+
+    // Children inherit the strategy and stay where they were spawned, so they can only spread eastwards
+    const expectedOutput = "alien 0 spawned alien 1 in B\nalien 1 spawned alien 2 in C\n"
+    if buf.String() != expectedOutput {
+        t.Errorf("Wrong spawns, expected:\n%s!= actual:\n%s", expectedOutput, buf.String())
+    } else if len(testWorld.Aliens) != 3 || testWorld.Cities["D"].Alien() != nil {
+        t.Errorf("Population should stop growing at the cap of 3 aliens")
+    } else if testWorld.Cities["C"].Alien() != testWorld.Aliens["2"] {
+        t.Errorf("Alien 2 should stay in C where it was spawned")
+    }
+
+    // Children never take the name of an alien that was in the world, and defenders don't spawn
+    otherWorld := worldx.WorldX{}
+    otherWorld.ReadWorldMap(strings.NewReader("A east=B\nC east=D\nE\n"))
+    otherWorld.CreateAlien("x", []string{"A"})
+    otherWorld.CreateAlien("7", []string{"E"})
+    otherWorld.CreateDefender("d", []string{"C"})
+    if err := otherWorld.RemoveAlien("7"); err != nil {
+        t.Fatalf("Unexpected error removing alien: %v", err)
+    }
+
+    buf.Reset()
+    stay := worldx.MovementStrategyFunc(func(*worldx.Alien, []worldx.Road, *rand.Rand) int { return -1 })
+    options = worldx.SimulationOptions{MaxIterations: 1, SpawnEvery: 1, Strategy: stay, DefenderStrategy: stay}
+    otherWorld.RunSimulationWithOptions(bufio.NewWriter(buf), options)
+
+    if buf.String() != "alien x spawned alien 8 in B\n" {
+        t.Errorf("Wrong spawns, expected a child named 8 in B, actual:\n%s", buf.String())
+    } else if len(otherWorld.Defenders) != 1 || otherWorld.Cities["D"].Alien() != nil {
+        t.Errorf("Defenders shouldn't spawn")
+    }
+}
+
+func TestPortals(t *testing.T) {
+    const inputWorldMap = `A portal="Far Away" east=B
+B portal=C
+"Far Away"
+C portal=B portal=A
+`
+    const expectedWorldMap = `A east=B portal=C portal="Far Away"
+B west=A portal=C
+C portal=A portal=B
+"Far Away" portal=A
+`
+
+    testWorld := worldx.WorldX{}
+    if _, err := testWorld.ReadWorldMapWithOptions(strings.NewReader(inputWorldMap), worldx.ReadOptions{}); err != nil {
+        t.Fatalf("Unexpected error: %v", err)
+    } else if testWorld.String() != expectedWorldMap {
+        t.Fatalf("Wrong portals, expected:\n%s!= actual:\n%s", expectedWorldMap, testWorld.String())
+    }
+
+    farAway := testWorld.Cities["Far Away"]
+    if portals := farAway.Portals(); len(portals) != 1 || portals[0] != testWorld.Cities["A"] || farAway.IsIsolated() {
+        t.Errorf("Far Away should only have a portal to A: %v", portals)
+    }
+    if _, err := new(worldx.WorldX).ReadWorldMapWithOptions(strings.NewReader("A portal=B:2\n"),
+        worldx.ReadOptions{}); err == nil {
+        t.Errorf("Portals with a length should be rejected")
+    }
+
+    // The alien in Far Away can only take the portal to A and destroys it, severing its portals
+    testWorld.CreateAlien("0", []string{"Far Away"})
+    testWorld.CreateAlien("1", []string{"A"})
+    testWorld.Aliens["1"].SetStrategy(
+        worldx.MovementStrategyFunc(func(*worldx.Alien, []worldx.Road, *rand.Rand) int { return -1 }))
+    testWorld.RunSimulationWithOptions(bufio.NewWriter(new(bytes.Buffer)), worldx.SimulationOptions{MaxIterations: 1})
+
+    const destroyedWorldMap = `B portal=C
+C portal=B
+"Far Away"
+`
+    if testWorld.String() != destroyedWorldMap || !farAway.IsIsolated() {
+        t.Errorf("A should be destroyed with its portals:\n%s", testWorld.String())
+    }
+}
+
+func TestRegions(t *testing.T) {
+    const inputWorldMap = `%region North A B
+A east=B south=C
+B
+C region=South east=D
+D region=South
+%region South E
+E
+`
+
+    testWorld := worldx.WorldX{}
+    testWorld.ReadWorldMap(strings.NewReader(inputWorldMap))
+    if regions := testWorld.Regions(); len(regions) != 2 || regions[0] != "North" || regions[1] != "South" {
+        t.Fatalf("Wrong regions: %v", regions)
+    } else if north := testWorld.RegionString("North"); north != "A east=B region=North\nB west=A region=North\n" {
+        t.Errorf("Only the cities of the region and the roads between them should be rendered:\n%s", north)
+    } else if errs := testWorld.Validate("South"); errs != nil {
+        t.Errorf("Unexpected validation errors: %v", errs)
+    }
+
+    westwards := worldx.MovementStrategyFunc(func(alien *worldx.Alien, roads []worldx.Road, _ *rand.Rand) int {
+        for i, road := range roads {
+            if road.Direction == worldx.West {
+                return i
+            }
+        }
+        return -1
+    })
+    for i, city := range []string{"A", "B", "D"} {
+        testWorld.CreateAlien(strconv.Itoa(i), []string{city})
+    }
+    testWorld.RunSimulationWithOptions(bufio.NewWriter(new(bytes.Buffer)),
+        worldx.SimulationOptions{MaxIterations: 3, Strategy: westwards})
+
+    expectedStats := []worldx.RegionStats{
+        {Name: "North", InitialCities: 2, Cities: 1, DestroyedCities: 1, SurvivingAliens: 0, FirstFall: 0},
+        {Name: "South", InitialCities: 3, Cities: 3, DestroyedCities: 0, SurvivingAliens: 1, FirstFall: -1},
+    }
+    stats := testWorld.RegionStats()
+    if len(stats) != len(expectedStats) {
+        t.Fatalf("Wrong number of regions: %v", stats)
+    }
+    for i := range stats {
+        if stats[i] != expectedStats[i] {
+            t.Errorf("Wrong stats, expected: %s != actual: %s", expectedStats[i], stats[i])
+        }
+    }
+    if rate := stats[0].SurvivalRate(); rate != 0.5 {
+        t.Errorf("Half of the northern region should survive, got %v", rate)
+    }
+}
+
+func TestRunBatch(t *testing.T) {
+    grid := getGridTestWorld(4, 0)
+    worldMap := []byte(grid.String())
+    options := worldx.BatchOptions{Runs: 50, Aliens: 4, Workers: 3, Seed: 1,
+        Simulation: worldx.SimulationOptions{MaxIterations: 100}}
+
+    result, _, err := worldx.RunBatch(worldMap, worldx.ReadOptions{}, options)
+    if err != nil {
+        t.Fatalf("Unexpected error: %v", err)
+    }
+
+    runs, destroyed := 0, 0
+    for cities, count := range result.DestroyedCities {
+        runs, destroyed = runs+count, destroyed+cities*count
+    }
+    destructions := 0
+    for _, count := range result.CityDestructions {
+        destructions += count
+    }
+    if runs != options.Runs || len(result.QuietIterations) != options.Runs {
+        t.Errorf("Every run should be counted once: %+v", result)
+    } else if destructions != destroyed || 2*destroyed+result.SurvivingAliens != options.Runs*options.Aliens {
+        t.Errorf("Every destroyed city should kill two aliens: %+v", result)
+    } else if p50, p100 := result.QuietPercentile(50), result.QuietPercentile(100); p50 > p100 || p100 > 100 {
+        t.Errorf("Wrong percentiles of iterations until quiet: p50 %d, max %d", p50, p100)
+    }
+
+    options.Workers = 1
+    if again, _, _ := worldx.RunBatch(worldMap, worldx.ReadOptions{}, options); !reflect.DeepEqual(result, again) {
+        t.Errorf("Batches with the same seed should have the same result:\n%+v\n!=\n%+v", result, again)
+    }
+
+    // An alien that keeps moving without any event only goes quiet when the simulation reaches its maximum
+    options = worldx.BatchOptions{Runs: 2, Aliens: 1, Seed: 1, Simulation: worldx.SimulationOptions{MaxIterations: 30}}
+    result, _, err = worldx.RunBatch([]byte("A north=B\n"), worldx.ReadOptions{}, options)
+    if err != nil || result.QuietPercentile(0) != 30 {
+        t.Errorf("Simulations should go quiet when they stop, not after their last event: %v", result.QuietIterations)
+    }
+
+    options.Aliens = 17
+    if _, _, err := worldx.RunBatch(worldMap, worldx.ReadOptions{}, options); err == nil {
+        t.Errorf("Batches with more aliens than cities should be rejected")
+    }
+}
+
+func TestClone(t *testing.T) {
+    const inputWorldMap = `A east=B:3 portal=D population=10
+B >south=C
+C west=D
+D region=West
+`
+
+    testWorld := worldx.WorldX{}
+    testWorld.ReadWorldMap(strings.NewReader(inputWorldMap))
+    testWorld.SetSeed(3)
+    testWorld.CreateAlien("0", []string{"A"})
+    testWorld.CreateAlien("1", []string{"C"})
+    testWorld.CreateDefender("d", []string{"D"})
+    original := testWorld.String()
+
+    clone := testWorld.Clone()
+    if clone.String() != original || clone.Cities["A"] == testWorld.Cities["A"] ||
+        clone.Cities["A"].Alien() != clone.Aliens["0"] || clone.Aliens["0"].Location() != clone.Cities["A"] {
+        t.Fatalf("Clone should have copies of the cities and aliens pointing to each other:\n%s", clone.String())
+    }
+
+    // Simulations of the world and its clone continue with copies of the same random source
+    options := worldx.SimulationOptions{MaxIterations: 20}
+    var outputs [2]*bytes.Buffer
+    for i, world := range []*worldx.WorldX{clone, testWorld.Clone()} {
+        outputs[i] = new(bytes.Buffer)
+        world.RunSimulationWithOptions(bufio.NewWriter(outputs[i]), options)
+        outputs[i].WriteString(world.String())
+    }
+
+    if outputs[0].String() != outputs[1].String() {
+        t.Errorf("Clones should have the same result:\n%s\n!=\n%s", outputs[0], outputs[1])
+    } else if testWorld.String() != original || len(testWorld.Aliens) != 2 || testWorld.Aliens["0"].IsTravelling() {
+        t.Errorf("Simulating the clones shouldn't change the world:\n%s", testWorld.String())
+    }
+}
+
+func TestCloneLongChain(t *testing.T) {
+    // Cloning follows the roads without recursing, a long chain fits in a small stack
+    defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+
+    chainWorld := worldx.WorldX{}
+    previous := chainWorld.CreateCity("0")
+    for i := 1; i < 100000; i++ {
+        city := chainWorld.CreateCity(strconv.Itoa(i))
+        chainWorld.AddConnection(previous, city, worldx.East)
+        previous = city
+    }
+    chainWorld.CreateAlien("a", []string{"0"})
+
+    clone := chainWorld.Clone()
+    if len(clone.Cities) != len(chainWorld.Cities) || clone.Cities["1"].Connection(worldx.West) != clone.Cities["0"] ||
+        clone.Cities["0"].Alien() != clone.Aliens["a"] {
+        t.Error("Clone should have copies of every city of the chain pointing to each other")
+    }
+}
+
+func TestSnapshot(t *testing.T) {
+    testWorld := worldx.WorldX{}
+    testWorld.ReadWorldMap(strings.NewReader("A east=B:2\nB\n"))
+    testWorld.CreateAlien("0", []string{"A"})
+
+    var snapshots []worldx.Snapshot
+    options := worldx.SimulationOptions{MaxIterations: 2, OnIteration: func(s worldx.Snapshot) {
+        snapshots = append(snapshots, s)
+    }}
+    testWorld.RunSimulationWithOptions(bufio.NewWriter(new(bytes.Buffer)), options)
+
+    if len(snapshots) != 2 || snapshots[0].Iteration != 0 || snapshots[1].Iteration != 1 {
+        t.Fatalf("There should be a snapshot of every iteration: %+v", snapshots)
+    }
+
+    travelling := snapshots[0].Aliens[0]
+    if travelling.City != "" || travelling.From != "A" || travelling.To != "B" || travelling.Remaining != 1 {
+        t.Errorf("Alien should be travelling from A to B in the first snapshot: %+v", travelling)
+    } else if arrived := snapshots[1].Aliens[0]; arrived.City != "B" || snapshots[1].Cities[1].Alien != "0" {
+        t.Errorf("Alien should be in B in the second snapshot: %+v", snapshots[1])
+    }
+
+    testWorld.AddConnection(testWorld.Cities["B"], testWorld.CreateCity("C"), worldx.East)
+    if len(snapshots[1].Cities) != 2 || snapshots[1].Cities[1].Line != "B west=A:2" {
+        t.Errorf("Snapshots shouldn't change with the world: %+v", snapshots[1].Cities)
+    }
+}
+
+func TestCheckpoint(t *testing.T) {
+    testWorld := getGridTestWorld(6, 8)
+    testWorld.SetRoadLength(testWorld.Cities["1"], worldx.West, 3)
+    testWorld.AddPortal(testWorld.Cities["0"], testWorld.Cities["35"])
+    var checkpoints []*bytes.Buffer
+    options := worldx.SimulationOptions{MaxIterations: 60, AlienHealth: 2, RebuildAfter: 5, SpawnEvery: 4,
+        PopulationCap: 10, BridgeCollapseChance: 0.1, QuarantineChance: 0.02, Seed: 42, CheckpointEvery: 7,
+        OnCheckpoint: func(w *worldx.WorldX) {
+            checkpoints = append(checkpoints, new(bytes.Buffer))
+            if err := w.WriteCheckpoint(checkpoints[len(checkpoints)-1]); err != nil {
+                t.Fatal(err)
+            }
+        }}
+    output := new(bytes.Buffer)
+    testWorld.RunSimulationWithOptions(bufio.NewWriter(output), options)
+    final := testWorld.String() + testWorld.Summary().String()
+
+    if len(checkpoints) == 0 {
+        t.Fatal("Simulation should have written checkpoints")
+    }
+    for i, checkpoint := range checkpoints {
+        resumed, err := worldx.ReadCheckpoint(checkpoint)
+        if err != nil {
+            t.Fatalf("Checkpoint %d: %v", i, err)
+        }
+        resumedOutput := new(bytes.Buffer)
+        resumed.RunSimulationWithOptions(bufio.NewWriter(resumedOutput), resumed.Options())
+
+        if result := resumed.String() + resumed.Summary().String(); result != final {
+            t.Errorf("Checkpoint %d: resumed simulation should have the same result:\n%s\n!=\n%s", i, result, final)
+        } else if !strings.HasSuffix(output.String(), resumedOutput.String()) {
+            t.Errorf("Checkpoint %d: resumed simulation should print the rest of the events:\n%s", i, resumedOutput)
+        }
+    }
+
+    if _, err := worldx.ReadCheckpoint(strings.NewReader(`{"Version": 2}`)); err == nil {
+        t.Error("Checkpoints of unknown versions shouldn't be read")
+    }
+}
+
+func TestChainedInvasions(t *testing.T) {
+    testWorld := getGridTestWorld(6, 8)
+    testWorld.SetRoadLength(testWorld.Cities["1"], worldx.West, 3)
+    testWorld.AddPortal(testWorld.Cities["0"], testWorld.Cities["35"])
+    for _, name := range []string{"P=NP", "# hash", "%percent", "colon:3", `"quoted"`, "north=B", ">east", "portal=x"} {
+        testWorld.AddConnection(testWorld.Cities["35"], testWorld.CreateCity(name), worldx.East)
+        testWorld.CreateAlien("alien "+name, []string{name})
+    }
+
+    for round := 0; round < 3; round++ {
+        options := worldx.SimulationOptions{MaxIterations: 20, BridgeCollapseChance: 0.2, QuarantineChance: 0.1,
+            Seed: int64(round + 1)}
+        testWorld.RunSimulationWithOptions(bufio.NewWriter(new(bytes.Buffer)), options)
+
+        output := testWorld.String()
+        testWorld = worldx.WorldX{}
+        if _, err := testWorld.ReadWorldMapWithOptions(strings.NewReader(output), worldx.ReadOptions{}); err != nil {
+            t.Fatalf("Round %d: the final world should be read back: %v\n%s", round, err, output)
+        } else if testWorld.String() != output {
+            t.Fatalf("Round %d: the world read back should be the same:\n%s\n!=\n%s", round, testWorld.String(), output)
+        } else if errs := testWorld.Validate(); len(errs) > 0 {
+            t.Fatalf("Round %d: the world read back should be valid: %v", round, errs)
+        }
+        testWorld.SetSeed(int64(round + 1))
+        testWorld.GenerateAliens(len(testWorld.Cities) / 4)
+    }
+}
+
+func TestDiff(t *testing.T) {
+    before, after := worldx.WorldX{}, worldx.WorldX{}
+    before.ReadWorldMap(strings.NewReader("A east=B\nB east=C\nC east=D portal=E\nD\nE\nF\nG\nH\nI south=J\nJ\n"))
+    after.ReadWorldMap(strings.NewReader("A east=B\nB\nD portal=E\nE\nF\nG\nH\nI\nJ\nK\n"))
+    diff := worldx.Diff(&before, &after)
+
+    expected := "1 removed cities: C\n1 added cities: K\n" +
+        "7 removed roads: B east=C, C east=D, C west=B, C portal=E, D west=C, I south=J, J north=I\n" +
+        "1 added roads: D portal=E\n2 isolated cities: I, J\n" +
+        "2 split components: {A B C D E} split in {A B} {D E}, {I J} split in {I} {J}\n"
+    if diff.String() != expected {
+        t.Errorf("Diff should be:\n%s\ngot:\n%s", expected, diff.String())
+    }
+
+    expectedUnified := "--- before\n+++ after\n@@ -1,10 +1,10 @@\n A east=B\n-B east=C west=A\n+B west=A\n" +
+        "-C east=D west=B portal=E\n-D west=C\n+D portal=E\n-E portal=C\n+E portal=D\n F\n G\n H\n" +
+        "-I south=J\n+I\n-J north=I\n+J\n+K\n"
+    if unified := diff.Unified(false); unified != expectedUnified {
+        t.Errorf("Unified diff should be:\n%s\ngot:\n%s", expectedUnified, unified)
+    }
+    if same := worldx.Diff(&before, &before); !same.IsEmpty() || same.Unified(true) != "" || same.String() != "" {
+        t.Errorf("Diff of the same world should be empty: %+v", same)
+    }
+}
+
+func TestEditing(t *testing.T) {
+    testWorld := worldx.WorldX{}
+    testWorld.ReadWorldMap(strings.NewReader("A east=B portal=C\nB east=C\nC >south=D\nD portal=B\nE\n"))
+    alien := testWorld.CreateAlien("0", []string{"A"})
+    defender := testWorld.CreateDefender("1", []string{"D"})
+
+    if err := testWorld.RemoveConnection(testWorld.Cities["A"], worldx.North); err == nil {
+        t.Error("Removing a road that doesn't exist should fail")
+    } else if err = testWorld.RemoveConnection(testWorld.Cities["B"], worldx.East); err != nil {
+        t.Error(err)
+    }
+    if err := testWorld.RenameCity("C", "A"); err == nil {
+        t.Error("Renaming a city with the name of another should fail")
+    } else if err = testWorld.RenameCity("C", "Z"); err != nil {
+        t.Error(err)
+    }
+    if err := testWorld.MoveAlien(alien, testWorld.Cities["D"]); err == nil {
+        t.Error("Moving an alien to a city with another should fail")
+    } else if err = testWorld.MoveAlien(alien, testWorld.Cities["E"]); err != nil {
+        t.Error(err)
+    } else if !alien.IsTrapped() || testWorld.Cities["A"].Alien() != nil || testWorld.Cities["E"].Alien() != alien {
+        t.Error("Alien should be trapped in E and A should be empty")
+    }
+    if err := testWorld.DeleteCity("D"); err != nil {
+        t.Error(err)
+    } else if err = testWorld.DeleteCity("D"); err == nil {
+        t.Error("Deleting a city twice should fail")
+    } else if len(testWorld.Defenders) != 0 || defender.Location() != nil {
+        t.Error("Defender should be deleted with its city")
+    }
+    if err := testWorld.RemoveAlien("0"); err != nil {
+        t.Error(err)
+    } else if err = testWorld.RemoveAlien("0"); err == nil || testWorld.Cities["E"].Alien() != nil {
+        t.Error("Alien should be removed from the world and its city once")
+    }
+
+    if expected := "A east=B portal=Z\nB west=A\nE\nZ portal=A\n"; testWorld.String() != expected {
+        t.Errorf("World should be:\n%s\ngot:\n%s", expected, testWorld.String())
+    } else if errs := testWorld.Validate(); len(errs) > 0 {
+        t.Errorf("World should be valid after editing it: %v", errs)
+    } else if summary := testWorld.Summary(); summary.DestroyedCities != 0 {
+        t.Errorf("Deleted cities shouldn't count as destroyed: %v", summary)
+    }
+
+    // Comments and `%region` directives follow the cities they belong to
+    commentedWorld, other := worldx.WorldX{}, worldx.WorldX{}
+    commentedWorld.ReadWorldMap(strings.NewReader(
+        "# First\nA east=B # Road\nB\nC\n%region R A C\n%region S B # Gone\n"))
+    other.ReadWorldMap(strings.NewReader("# Other\nD\n%region R D\n"))
+    if err := commentedWorld.RenameCity("A", "Z"); err != nil {
+        t.Error(err)
+    } else if err = commentedWorld.DeleteCity("B"); err != nil {
+        t.Error(err)
+    } else if errs := commentedWorld.Merge(&other); len(errs) > 0 {
+        t.Error(errs)
+    }
+    expected := "C\n# Other\nD\n# First\nZ # Road\n%region R Z C\n%region R D\n"
+    if commentedWorld.String() != expected {
+        t.Errorf("Edited world should be:\n%s\ngot:\n%s", expected, commentedWorld.String())
+    }
+}
+
+func TestMerge(t *testing.T) {
+    testWorld, other, conflicting := worldx.WorldX{}, worldx.WorldX{}, worldx.WorldX{}
+    testWorld.ReadWorldMap(strings.NewReader("A east=B population=10\nB\n"))
+    other.ReadWorldMap(strings.NewReader("%directions cardinal vertical\nA up=C portal=D population=10\nB east=C:2\nC\nD\n"))
+    conflicting.ReadWorldMap(strings.NewReader("A east=C population=20\nC\n"))
+
+    if errs := testWorld.Merge(&conflicting); len(errs) != 2 {
+        t.Errorf("Merging a road and an attribute that conflict should fail: %v", errs)
+    } else if errs = testWorld.Merge(&other); len(errs) > 0 {
+        t.Error(errs)
+    }
+
+    expected := "%worldx 1\n%directions north south east west up down\nA east=B up=C portal=D population=10\n" +
+        "B east=C:2 west=A\nC west=B:2 down=A\nD portal=A\n"
+    if testWorld.String() != expected {
+        t.Errorf("Merged world should be:\n%s\ngot:\n%s", expected, testWorld.String())
+    } else if errs := testWorld.Validate(); len(errs) > 0 {
+        t.Errorf("Merged world should be valid: %v", errs)
+    }
+}
+
+func TestReadWorldMapConflicts(t *testing.T) {
+    testWorld := worldx.WorldX{}
+    diagnostics, err := testWorld.ReadWorldMapWithOptions(strings.NewReader(
+        "C north=A\nA north=B:2 north=D\nB south=A:3\nE north=B\nA east=F east=F\n"), worldx.ReadOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    expected := []worldx.Diagnostic{
+        {Line: 2, Message: "ignored north=D, road north of A already leads to B", Unfixable: true},
+        {Line: 3, Message: "ignored south=A:3, road south of B is already 2 long", Unfixable: true},
+        {Line: 4, Message: "ignored road south of B back to E, it already leads to A", Unfixable: true},
+    }
+    // Roads are kept as written, the road back from B to E would replace the road back to A
+    formatted := "A north=B:2 south=C east=F\nB south=A:2\nC north=A\nE >north=B\nF west=A\n"
+    if !reflect.DeepEqual(diagnostics, expected) {
+        t.Errorf("Conflicts should be reported:\n%v\ngot:\n%v", expected, diagnostics)
+    } else if testWorld.String() != formatted {
+        t.Errorf("World should be:\n%s\ngot:\n%s", formatted, testWorld.String())
+    }
+}
+
+func TestWorldStringKeepsCommentsAndDirectives(t *testing.T) {
+    const inputWorldMap = `%worldx 1
+# Roads of the valley
+
+%directions cardinal vertical
+
+# The capital
+Foo north=Bar up=Baz   # Busy road
+Bar  south=Foo
+%region Valley Foo Bar # Lowlands
+# Last line
+`
+
+    testWorld := worldx.WorldX{}
+    testWorld.ReadWorldMap(strings.NewReader(inputWorldMap))
+    expected := `%worldx 1
+# Roads of the valley
+
+%directions cardinal vertical
+
+Bar south=Foo
+Baz down=Foo
+# The capital
+Foo north=Bar up=Baz # Busy road
+%region Valley Foo Bar # Lowlands
+# Last line
+`
+    if testWorld.String() != expected {
+        t.Fatalf("World should be:\n%s\ngot:\n%s", expected, testWorld.String())
+    }
+
+    rereadWorld := worldx.WorldX{}
+    rereadWorld.ReadWorldMap(strings.NewReader(expected))
+    if rereadWorld.String() != expected {
+        t.Errorf("World read back should be:\n%s\ngot:\n%s", expected, rereadWorld.String())
+    }
+
+    uncommentedWorld := worldx.WorldX{}
+    options := worldx.ReadOptions{DropComments: true}
+    if _, err := uncommentedWorld.ReadWorldMapWithOptions(strings.NewReader(inputWorldMap), options); err != nil {
+        t.Fatal(err)
+    }
+    uncommented := "%worldx 1\n\n%directions cardinal vertical\n\nBar south=Foo\nBaz down=Foo\nFoo north=Bar up=Baz\n" +
+        "%region Valley Foo Bar\n"
+    if uncommentedWorld.String() != uncommented {
+        t.Errorf("World read without comments should be:\n%s\ngot:\n%s", uncommented, uncommentedWorld.String())
+    }
+
+    // The header is written again once the directions change, cities out of a region leave its directive
+    testWorld.SetDirections(worldx.North, worldx.South, worldx.East, worldx.West)
+    testWorld.Cities["Bar"].DeleteAttribute("region")
+    expected = `# Roads of the valley
+
+Bar south=Foo
+Baz down=Foo
+# The capital
+Foo north=Bar up=Baz # Busy road
+%region Valley Foo # Lowlands
+# Last line
+`
+    if testWorld.String() != expected {
+        t.Errorf("Changed world should be:\n%s\ngot:\n%s", expected, testWorld.String())
+    }
+}